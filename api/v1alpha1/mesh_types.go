@@ -51,6 +51,11 @@ type MeshSpec struct {
 	// +optional
 	WatchNamespaces []string `json:"watch_namespaces,omitempty"`
 
+	// Selects additional namespaces to include in the mesh network by their labels.
+	// Namespaces join or leave the mesh as their labels change.
+	// +optional
+	WatchNamespaceSelector *metav1.LabelSelector `json:"watch_namespace_selector,omitempty"`
+
 	// Add user tokens to the JWT Security Service.
 	// +optional
 	UserTokens []UserToken `json:"user_tokens,omitempty"`
@@ -75,14 +80,116 @@ type Images struct {
 // MeshStatus describes the observed state of a Grey Matter mesh.
 type MeshStatus struct {
 	SidecarList []string `json:"sidecar_list,omitempty"`
+
+	// The most recent generation of the Mesh successfully applied by the operator.
+	// +optional
+	ObservedGeneration int64 `json:"observed_generation,omitempty"`
+
+	// The revision of the operator CUE (e.g. a GitOps commit SHA) last used to successfully apply the Mesh.
+	// +optional
+	CUERevision string `json:"cue_revision,omitempty"`
+
+	// The GitOps branch or tag that CUERevision was resolved from, if any.
+	// +optional
+	CUERef string `json:"cue_ref,omitempty"`
+
+	// The latest observations of the Mesh's installation progress.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Objects that could not be removed while tearing down a deleted Mesh.
+	// +optional
+	Leftovers []string `json:"leftovers,omitempty"`
+
+	// The k8s objects last applied from the CUE's k8s_manifests.
+	// Objects that are removed from the CUE are pruned on the next apply.
+	// +optional
+	Inventory []InventoryEntry `json:"inventory,omitempty"`
+
+	// The Control and Catalog objects last applied from the CUE's mesh_configs.
+	// Objects that are removed from the CUE are deleted once the rest have been applied.
+	// +optional
+	ConfigInventory []ConfigInventoryEntry `json:"config_inventory,omitempty"`
+
+	// The progress of each phase of the last rollout of core components, in the order they are applied.
+	// A phase is only applied once the workloads of the phases before it are ready.
+	// +optional
+	Rollout []RolloutPhase `json:"rollout,omitempty"`
+}
+
+// InventoryEntry identifies a k8s object applied for a Mesh.
+type InventoryEntry struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ConfigInventoryEntry identifies a Control or Catalog object applied for a Mesh.
+type ConfigInventoryEntry struct {
+	// The object's kind, e.g. cluster, route, listener, or catalogservice.
+	Kind string `json:"kind"`
+	Key  string `json:"key"`
+	// The Catalog mesh that a catalogservice belongs to.
+	// +optional
+	MeshID string `json:"mesh_id,omitempty"`
 }
 
+// RolloutPhase is the progress of one phase of a rollout of core components.
+type RolloutPhase struct {
+	// e.g. foundation, redis, control, catalog, or edge.
+	Name string `json:"name"`
+	// One of Pending, Progressing, Ready, or Failed.
+	State string `json:"state"`
+	// Why the phase failed, or which of its workloads are not yet ready.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// States of a RolloutPhase.
+const (
+	// The phase has not been applied, e.g. because an earlier phase is not ready.
+	RolloutPending = "Pending"
+	// The phase has been applied and its workloads are rolling out.
+	RolloutProgressing = "Progressing"
+	// The phase's workloads have all rolled out.
+	RolloutReady = "Ready"
+	// The phase could not be applied, or its workloads did not roll out in time.
+	RolloutFailed = "Failed"
+)
+
+// Condition types reported in a Mesh's status.
+const (
+	// Core component manifests extracted from CUE have been applied to the cluster.
+	ConditionManifestsApplied = "ManifestsApplied"
+	// The operator is able to read from and write to the mesh's Control API.
+	ConditionControlReachable = "ControlReachable"
+	// The operator is able to reach the mesh's Catalog API.
+	ConditionCatalogReachable = "CatalogReachable"
+	// Core Grey Matter configuration extracted from CUE has been applied to Control and Catalog.
+	ConditionCoreConfigApplied = "CoreConfigApplied"
+	// All of the above conditions are true.
+	ConditionReady = "Ready"
+	// A deleted Mesh's core components, copied secrets, and mesh configuration have been removed.
+	ConditionTeardownComplete = "TeardownComplete"
+	// The latest revision synchronized from the GitOps repository passed signature verification and validation, and is active.
+	ConditionRevisionValid = "RevisionValid"
+)
+
 // +kubebuilder:object:root=true
 // +kubebuilder:subresource:status
 // +kubebuilder:resource:scope=Cluster
 // +kubebuilder:printcolumn:name="Install Namespace",type=string,JSONPath=`.spec.install_namespace`
 // +kubebuilder:printcolumn:name="Release Version",type=string,JSONPath=`.spec.release_version`
 // +kubebuilder:printcolumn:name="Zone",type=string,JSONPath=`.spec.zone`
+// +kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+// +kubebuilder:printcolumn:name="Reason",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].reason`
+// +kubebuilder:printcolumn:name="Ref",type=string,JSONPath=`.status.cue_ref`,priority=1
+// +kubebuilder:printcolumn:name="Revision",type=string,JSONPath=`.status.cue_revision`,priority=1
+// +kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Mesh defines a Grey Matter mesh's desired state and describes its observed state.
 type Mesh struct {
@@ -22,25 +22,35 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/certrotation"
 	"github.com/greymatter-io/operator/pkg/cfsslsrv"
+	"github.com/greymatter-io/operator/pkg/controllers"
 	"github.com/greymatter-io/operator/pkg/cuemodule"
 	"github.com/greymatter-io/operator/pkg/gmapi"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
 	"github.com/greymatter-io/operator/pkg/mesh_install"
+	"github.com/greymatter-io/operator/pkg/plan"
 	"github.com/greymatter-io/operator/pkg/sync"
 	"github.com/greymatter-io/operator/pkg/webhooks"
+	"github.com/greymatter-io/operator/pkg/wellknown"
 	configv1 "github.com/openshift/api/config/v1"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/selection"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
@@ -63,19 +73,63 @@ func init() {
 // Global config flags
 var (
 	cueRoot    string
+	overlayDir string
 	zapDevMode bool
 	pprofAddr  string
 
+	// Whether to configure Control and Catalog with HTTP requests rather than the greymatter CLI.
+	nativeGMClient bool
+
+	// Whether to take ownership of conflicting fields when applying core manifests.
+	forceApplyConflicts bool
+
+	// How long to wait for each rollout phase of core components to become ready.
+	rolloutTimeout time.Duration
+
+	// Whether to log planned changes to Meshes instead of applying them.
+	dryRun bool
+
+	// Configuration flags for the CA used to issue webhook certs and SPIRE's intermediate CA.
+	caSource     string
+	caSecretName string
+	caCertPath   string
+	caKeyPath    string
+
+	// Fraction of an issued cert's lifetime after which it is reissued.
+	certRotationFraction float64
+
 	// Configuration flags for fetching the initial operator
 	// config repository on startup with Git.
 	syncRepo           string
 	syncSSHKeyPath     string
 	syncSSHKeyPassword string
 	syncBranch         string
+	syncTag            string
+	syncCommit         string
+	syncSemver         string
 	syncInterval       int
+	syncSSHKnownHosts  string
+	syncHTTPSUsername  string
+	syncHTTPSPassword  string
+	syncHTTPSSecret    string
+	syncCABundlePath   string
+	syncInsecureTLS    bool
+	syncGPGKeyRing     string
+	syncSSHSigningKeys string
+	syncVerifyTags     bool
+	syncWebhookAddr    string
+	syncOCIArtifact    string
+	syncTarballURL     string
+	syncTarballSHA256  string
+	syncWebhookSecret  string
 )
 
 func main() {
+	// `operator plan` previews the changes the operator would make instead of running it.
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		os.Exit(runPlan(os.Args[2:]))
+	}
+
 	if err := run(); err != nil {
 		logger.Error(err, "Failed to run operator")
 		os.Exit(1)
@@ -90,15 +144,44 @@ func run() error {
 	}()
 
 	flag.StringVar(&cueRoot, "cueRoot", "core", "Path to the CUE module with Grey Matter config. Defaults to the current working directory.")
+	flag.StringVar(&overlayDir, "cueOverlayDir", "", "Directory with k8s and gm subdirectories of CUE files to unify on top of the CUE module.")
 	flag.BoolVar(&zapDevMode, "zapDevMode", false, "Configure zap logger in development mode.")
 	flag.StringVar(&pprofAddr, "pprofAddr", ":1234", "Address for pprof server; has no effect on release builds")
+	flag.BoolVar(&nativeGMClient, "nativeGMClient", false, "Configure Control and Catalog with HTTP requests instead of the greymatter CLI.")
+	flag.BoolVar(&dryRun, "dryRun", false, "Plan the changes to each Mesh and log them with a Planned Event instead of applying them.")
+	flag.DurationVar(&rolloutTimeout, "rolloutTimeout", mesh_install.DefaultRolloutTimeout, "How long to wait for the Deployments and StatefulSets of each rollout phase of core components to become ready before failing the rollout.")
+	flag.BoolVar(&forceApplyConflicts, "forceApplyConflicts", true, "Take ownership of fields in core manifests set by other field managers when applying them. If false, conflicting applies fail.")
+
+	// Flags that configure where the operator's root CA comes from.
+	flag.StringVar(&caSource, "caSource", "persisted", "Source of the root CA: 'persisted' (generated once and stored in caSecretName), 'secret' (provided in caSecretName), or 'file' (read from caCertPath and caKeyPath).")
+	flag.StringVar(&caSecretName, "caSecretName", "gm-operator-ca", "Name of the kubernetes.io/tls Secret in the gm-operator namespace holding the root CA.")
+	flag.StringVar(&caCertPath, "caCertPath", "", "Path to a PEM-encoded root CA, if caSource is 'file'.")
+	flag.StringVar(&caKeyPath, "caKeyPath", "", "Path to a PEM-encoded root CA key, if caSource is 'file'.")
+	flag.Float64Var(&certRotationFraction, "certRotationFraction", certrotation.DefaultFraction, "Fraction of their lifetime after which webhook server certs and SPIRE's intermediate CA are reissued.")
 
 	// Flags that enable sync configuration loading from a git repo.
 	flag.StringVar(&syncRepo, "repo", "", "Bootstrap repository for operator configuration.")
 	flag.StringVar(&syncSSHKeyPath, "sshPrivateKeyPath", "", "SSH key which has privileges to fetch the operators core configuration from Git.")
 	flag.StringVar(&syncSSHKeyPassword, "sshPrivateKeyPassword", "", "Password for the SSH key")
+	flag.StringVar(&syncOCIArtifact, "ociArtifact", "", "OCI artifact (e.g. registry.example.com/greymatter/core:1.0) to pull operator configuration from instead of a Git repository.")
+	flag.StringVar(&syncTarballURL, "tarballURL", "", "URL of a tarball to pull operator configuration from instead of a Git repository.")
+	flag.StringVar(&syncTarballSHA256, "tarballSHA256", "", "Expected SHA-256 checksum of the tarball. If not set, it is read from <tarballURL>.sha256 on every sync.")
 	flag.StringVar(&syncBranch, "branch", "main", "target branch to fetch and watch for changes in the core configuration repo.")
-	flag.IntVar(&syncInterval, "interval", 30, "Interval to watch sync core config repo.")
+	flag.StringVar(&syncTag, "tag", "", "Tag to sync in the core configuration repo instead of the head of the branch.")
+	flag.StringVar(&syncCommit, "commit", "", "Commit SHA to sync in the core configuration repo instead of the head of the branch. Takes precedence over tag and semver.")
+	flag.StringVar(&syncSemver, "semver", "", "Semver constraint (e.g. '~1.4'); the highest matching tag in the core configuration repo is synced instead of the head of the branch.")
+	flag.IntVar(&syncInterval, "interval", 30, "Interval in seconds to poll the core config repo. Defaults to 300 if syncWebhookAddr is set.")
+	flag.StringVar(&syncSSHKnownHosts, "sshKnownHostsPath", "", "known_hosts file for verifying SSH remotes. Defaults to the user's known_hosts files.")
+	flag.StringVar(&syncHTTPSUsername, "httpsUsername", "", "Username for HTTPS remotes. Defaults to 'git', which is accepted with GitHub and GitLab access tokens.")
+	flag.StringVar(&syncHTTPSPassword, "httpsPasswordPath", "", "File containing a password or access token for HTTPS remotes.")
+	flag.StringVar(&syncHTTPSSecret, "httpsAuthSecret", "", "Name of a kubernetes.io/basic-auth Secret in the gm-operator namespace with credentials for HTTPS remotes.")
+	flag.StringVar(&syncCABundlePath, "caBundlePath", "", "PEM-encoded CA bundle to trust for HTTPS remotes in addition to the system cert pool.")
+	flag.BoolVar(&syncInsecureTLS, "insecureSkipTLS", false, "Skip TLS verification for HTTPS remotes.")
+	flag.StringVar(&syncGPGKeyRing, "gpgKeyRingPath", "", "Armored GPG public keyring; if set, synced commits must be signed by one of its keys.")
+	flag.StringVar(&syncSSHSigningKeys, "sshSigningKeysPath", "", "authorized_keys or allowed_signers file; if set, synced commits must be signed by one of its SSH keys.")
+	flag.StringVar(&syncWebhookAddr, "syncWebhookAddr", "", "Address to serve a webhook at /sync that triggers an immediate sync on GitHub, GitLab, or Bitbucket push events.")
+	flag.StringVar(&syncWebhookSecret, "syncWebhookSecretPath", "", "File containing the secret used to verify sync webhook payloads. Required if syncWebhookAddr is set.")
+	flag.BoolVar(&syncVerifyTags, "verifyTags", false, "Also require synced tags to be signed by a trusted key, when syncing a tag or semver constraint.")
 
 	// Bind flags for Zap logger options.
 	opts := zap.Options{Development: zapDevMode}
@@ -110,18 +193,61 @@ func run() error {
 
 	//go http.ListenAndServe(pprofAddr, nil) // DEBUG
 
+	// Create a rest.Config that has settings for communicating with the K8s cluster.
+	restConfig := ctrl.GetConfigOrDie()
+
+	// Create a write+read client for making requests to the API server.
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return fmt.Errorf("failed to create initial client: %w", err)
+	}
+
+	// With webhooks triggering syncs, polling is only a fallback.
+	if syncWebhookAddr != "" && syncWebhookSecret == "" {
+		return errors.New("syncWebhookSecretPath is required if syncWebhookAddr is set")
+	}
+	if syncWebhookAddr != "" && !isFlagSet("interval") {
+		syncInterval = 300
+	}
+
 	// build sync options based on user configuration.
 	syncOpts := []func(*sync.Sync){}
+	syncOpts = append(syncOpts, sync.WithInterval(syncInterval))
 	syncOpts = append(syncOpts, sync.WithSSHInfo(syncSSHKeyPath, syncSSHKeyPassword))
+	syncOpts = append(syncOpts, sync.WithSSHKnownHosts(syncSSHKnownHosts))
+	syncOpts = append(syncOpts, sync.WithHTTPSAuth(syncHTTPSUsername, syncHTTPSPassword))
+	if syncHTTPSSecret != "" {
+		syncOpts = append(syncOpts, sync.WithHTTPSAuthSecret(c, "gm-operator", syncHTTPSSecret))
+	}
+	syncOpts = append(syncOpts, sync.WithTLSConfig(syncCABundlePath, syncInsecureTLS))
 	syncOpts = append(syncOpts, sync.WithRepoInfo(syncRepo, syncBranch))
+	syncOpts = append(syncOpts, sync.WithOCIArtifact(syncOCIArtifact), sync.WithTarball(syncTarballURL, syncTarballSHA256))
+	syncOpts = append(syncOpts, sync.WithCommit(syncCommit), sync.WithTag(syncTag), sync.WithSemverConstraint(syncSemver))
+	syncOpts = append(syncOpts, sync.WithSignatureVerification(syncGPGKeyRing, syncSSHSigningKeys, syncVerifyTags))
+
+	// CUE overlays unified on top of the CUE module whenever it is loaded.
+	// Overlays from labeled ConfigMaps are added by the overlay controller.
+	overlays := &cuemodule.Overlays{}
+	if overlayDir != "" {
+		dirOverlays, err := cuemodule.LoadOverlayDir(overlayDir)
+		if err != nil {
+			return fmt.Errorf("failed to load CUE overlays: %w", err)
+		}
+		overlays.Set("dir", dirOverlays)
+	}
 
 	// Create a context we can cancel and clean up our go routine with.
 	sync := sync.New(syncRepo, context.Background(), syncOpts...)
 
-	if syncRepo != "" {
-		// GitDir should be cueRoot (where the operator expects to load its config from)
-		cueRoot = "fetched_cue"
-		sync.GitDir = cueRoot
+	if sync.Remote != "" {
+		// Revisions are checked out in a staging directory and validated before
+		// cueRoot (where the operator expects to load its config from) is pointed at them.
+		cueRoot = "fetched_cue/active"
+		sync.GitDir = "fetched_cue/staging"
+		sync.ActiveDir = cueRoot
+		sync.Validate = func(dir string) error {
+			return cuemodule.DryRun(dir, overlays.List()...)
+		}
 		err := sync.Bootstrap()
 		if err != nil {
 			return fmt.Errorf("failed to load operator initial configuration: %w", err)
@@ -132,13 +258,30 @@ func run() error {
 	}
 
 	// Immediately load all CUE
-	operatorCUE, initialMesh, err := cuemodule.LoadAll(cueRoot)
+	operatorCUE, initialMesh, err := cuemodule.LoadAll(cueRoot, overlays.List()...)
 	if err != nil {
-		// initial load panics if unsuccessful, because we need valid config to start up
-		panic(err)
+		// We need valid config to start up, so report each CUE error and exit
+		cuemodule.LogError(logger, err)
+		return fmt.Errorf("failed to load CUE module from %s: %w", cueRoot, err)
 	}
 	logger.Info(fmt.Sprintf("Loaded CUE module from %s", cueRoot))
 
+	overlayLabelExists, err := labels.NewRequirement(wellknown.LABEL_CUE_OVERLAY, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+	meshLabelExists, err := labels.NewRequirement(wellknown.LABEL_MESH, selection.Exists, nil)
+	if err != nil {
+		return err
+	}
+	// Only cache the ConfigMaps watched for CUE overlays and the core manifests watched for drift.
+	selectors := cache.SelectorsByObject{
+		&corev1.ConfigMap{}: {Label: labels.NewSelector().Add(*overlayLabelExists)},
+	}
+	for _, obj := range controllers.DriftCorrectedObjects() {
+		selectors[obj] = cache.ObjectSelector{Label: labels.NewSelector().Add(*meshLabelExists)}
+	}
+
 	// Initialize operator options with set values.
 	// These values will not be replaced by any values set in a read configPath.
 	options := ctrl.Options{
@@ -149,35 +292,44 @@ func run() error {
 		Port:                    9443,
 		MetricsBindAddress:      ":8080",
 		HealthProbeBindAddress:  ":8081",
-	}
-
-	// Start up our CFSSL server for issuing two certs:
-	// 1) Webhook server certs (unless disabled in the sync config)
-	// 2) SPIRE's intermediate CA for issuing identities to workloads
-	cfssl, err := cfsslsrv.New(nil, nil)
-	if err != nil {
-		return fmt.Errorf("failed to configure CFSSL server: %w", err)
-	}
-	if err := cfssl.Start(); err != nil {
-		return fmt.Errorf("failed to start CFSSL server: %w", err)
+		NewCache:                cache.BuilderWithOptions(cache.Options{SelectorsByObject: selectors}),
 	}
 
 	// Create context for goroutine cleanup
 	ctx := ctrl.SetupSignalHandler()
 
 	// Initialize interface with greymatter CLI
-	gmcli, err := gmapi.New(ctx, operatorCUE)
+	var gmOpts []func(*gmapi.CLI)
+	if nativeGMClient {
+		gmOpts = append(gmOpts, gmapi.WithNativeClient())
+	}
+	gmcli, err := gmapi.New(ctx, gmOpts...)
 	if err != nil {
 		return err
 	}
 
-	// Create a rest.Config that has settings for communicating with the K8s cluster.
-	restConfig := ctrl.GetConfigOrDie()
+	// Select the CA that signs certs, so that they remain trusted across operator restarts.
+	var ca cfsslsrv.CertificateAuthority
+	switch caSource {
+	case "persisted":
+		ca = cfsslsrv.PersistedCA{Client: c, Namespace: "gm-operator", Name: caSecretName}
+	case "secret":
+		ca = cfsslsrv.SecretCA{Client: c, Namespace: "gm-operator", Name: caSecretName}
+	case "file":
+		ca = cfsslsrv.FileCA{CertPath: caCertPath, KeyPath: caKeyPath}
+	default:
+		return fmt.Errorf("unknown caSource %q", caSource)
+	}
 
-	// Create a write+read client for making requests to the API server.
-	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	// Start up our CFSSL server for issuing two certs:
+	// 1) Webhook server certs (unless disabled in the sync config)
+	// 2) SPIRE's intermediate CA for issuing identities to workloads
+	cfssl, err := cfsslsrv.NewFromAuthority(ctx, ca)
 	if err != nil {
-		return fmt.Errorf("failed to create initial client: %w", err)
+		return fmt.Errorf("failed to configure CFSSL server: %w", err)
+	}
+	if err := cfssl.Start(); err != nil {
+		return fmt.Errorf("failed to start CFSSL server: %w", err)
 	}
 
 	// Initialize controller-runtime manager with configured options
@@ -186,21 +338,61 @@ func run() error {
 		return fmt.Errorf("failed to initialize controller-manager: %w", err)
 	}
 
+	// Reissue the certs issued by CFSSL before they expire.
+	rotator := certrotation.New(mgr.GetEventRecorderFor("gm-operator"), certRotationFraction)
+
 	// Initialize manifests mesh_install.
-	inst, err := mesh_install.New(&c, operatorCUE, initialMesh, cueRoot, gmcli, cfssl, sync)
+	inst, err := mesh_install.New(&c, operatorCUE, initialMesh, cueRoot, overlays, gmcli, cfssl, rotator, sync)
 	if err != nil {
 		return fmt.Errorf("failed to initialize manifest mesh_install: %w", err)
 	}
+	inst.Recorder = mgr.GetEventRecorderFor("gm-operator")
+	inst.ForceApplyConflicts = forceApplyConflicts
+	inst.RolloutTimeout = rolloutTimeout
+	inst.DryRun = dryRun
 
 	// Initialize the webhooks loader.
-	wl, err := webhooks.New(&c, inst, gmcli, cfssl, mgr.GetWebhookServer)
+	wl, err := webhooks.New(&c, inst, gmcli, cfssl, rotator, mgr.GetWebhookServer)
 	if err != nil {
 		return err
 	}
 
-	// Register our webhooks loader and manifests mesh_install into the controller manager's start process queue.
+	// Register our webhooks loader, manifests mesh_install, and cert rotator into the controller manager's start process queue.
 	mgr.Add(wl)
 	mgr.Add(inst)
+	mgr.Add(rotator)
+	if sync.Remote != "" && syncWebhookAddr != "" {
+		mgr.Add(sync.WebhookServer(syncWebhookAddr, syncWebhookSecret))
+	}
+
+	// Register the Mesh reconciler, which drives installation, updates, and removal of meshes.
+	if err := (&controllers.MeshReconciler{Client: mgr.GetClient(), Installer: inst}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up Mesh controller: %w", err)
+	}
+
+	// Register the CUE overlay reconciler, which unifies overlays from labeled ConfigMaps with the CUE module.
+	if err := (&controllers.OverlayReconciler{
+		Client:    mgr.GetClient(),
+		Installer: inst,
+		Recorder:  mgr.GetEventRecorderFor("gm-operator"),
+		Namespace: "gm-operator",
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up CUE overlay controller: %w", err)
+	}
+
+	if err := (&controllers.DriftReconciler{
+		Client:    mgr.GetClient(),
+		Installer: inst,
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up drift controller: %w", err)
+	}
+
+	if err := (&controllers.NamespaceReconciler{
+		Client:    mgr.GetClient(),
+		Installer: inst,
+	}).SetupWithManager(mgr); err != nil {
+		return fmt.Errorf("failed to set up namespace controller: %w", err)
+	}
 
 	//+kubebuilder:scaffold:builder
 
@@ -217,3 +409,100 @@ func run() error {
 
 	return nil
 }
+
+// runPlan loads the operator CUE, unifies it with a Mesh, and prints the changes that applying it would make
+// to the live k8s objects and Control and Catalog objects. It returns the process exit code.
+func runPlan(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	root := fs.String("cueRoot", "core", "Path to the CUE module with Grey Matter config.")
+	overlayDir := fs.String("cueOverlayDir", "", "Directory with k8s and gm subdirectories of CUE files to unify on top of the CUE module.")
+	meshName := fs.String("mesh", "", "Name of a live Mesh to plan; its inventories are used to plan deletions. Defaults to the Mesh defined in the CUE.")
+	controlURL := fs.String("controlURL", "", "Base URL of the mesh's Control API. Defaults to its in-cluster URL.")
+	catalogURL := fs.String("catalogURL", "", "Base URL of the mesh's Catalog API. Defaults to its in-cluster URL.")
+	skipGM := fs.Bool("skipGM", false, "Do not compare Control and Catalog objects.")
+	output := fs.String("output", "text", "Output format: 'text' or 'json'.")
+	detailedExitCode := fs.Bool("detailedExitCode", false, "Exit with 2 instead of 0 if there are changes.")
+	opts := zap.Options{}
+	opts.BindFlags(fs)
+	fs.Parse(args)
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	fail := func(err error) int {
+		fmt.Fprintf(os.Stderr, "plan failed: %v\n", err)
+		return 1
+	}
+	if *output != "text" && *output != "json" {
+		return fail(fmt.Errorf("unknown output format %q", *output))
+	}
+
+	var overlays []cuemodule.Overlay
+	if *overlayDir != "" {
+		var err error
+		if overlays, err = cuemodule.LoadOverlayDir(*overlayDir); err != nil {
+			return fail(err)
+		}
+	}
+	operatorCUE, mesh, err := cuemodule.LoadAll(*root, overlays...)
+	if err != nil {
+		return fail(err)
+	}
+
+	restConfig, err := ctrl.GetConfig()
+	if err != nil {
+		return fail(err)
+	}
+	c, err := client.New(restConfig, client.Options{Scheme: scheme})
+	if err != nil {
+		return fail(err)
+	}
+	if *meshName != "" {
+		mesh = &v1alpha1.Mesh{}
+		if err := c.Get(context.Background(), client.ObjectKey{Name: *meshName}, mesh); err != nil {
+			return fail(err)
+		}
+	}
+	if err := operatorCUE.UnifyWithMesh(mesh); err != nil {
+		return fail(err)
+	}
+
+	var api *gmhttp.Client
+	if !*skipGM {
+		defaultControl, defaultCatalog := gmapi.APIURLs(mesh)
+		if *controlURL == "" {
+			*controlURL = defaultControl
+		}
+		if *catalogURL == "" {
+			*catalogURL = defaultCatalog
+		}
+		api = gmhttp.New(*controlURL, *catalogURL, nil)
+	}
+
+	p, err := plan.Make(context.Background(), c, api, operatorCUE, mesh)
+	if err != nil {
+		return fail(err)
+	}
+	if *output == "json" {
+		err = p.WriteJSON(os.Stdout)
+	} else {
+		err = p.WriteText(os.Stdout)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if *detailedExitCode && p.HasChanges() {
+		return 2
+	}
+	return 0
+}
+
+// isFlagSet reports whether a flag was set on the command line.
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
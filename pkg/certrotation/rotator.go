@@ -0,0 +1,158 @@
+// Package certrotation reissues certificates issued by the operator before they expire.
+package certrotation
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	logger = ctrl.Log.WithName("certrotation")
+
+	expiryTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gm_operator_cert_expiry_timestamp_seconds",
+		Help: "Time at which a certificate issued by the operator expires, in seconds since the epoch.",
+	}, []string{"cert"})
+	rotationTimestamp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gm_operator_cert_rotation_timestamp_seconds",
+		Help: "Time at which a certificate issued by the operator is scheduled to be reissued, in seconds since the epoch.",
+	}, []string{"cert"})
+	rotationsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "gm_operator_cert_rotations_total",
+		Help: "Number of attempts to reissue a certificate issued by the operator, by result.",
+	}, []string{"cert", "result"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(expiryTimestamp, rotationTimestamp, rotationsTotal)
+}
+
+// DefaultFraction is the fraction of a certificate's lifetime after which it is reissued by default.
+const DefaultFraction = 2.0 / 3.0
+
+// How often certificates are checked for rotation. Failed rotations are reattempted at the next check.
+const checkInterval = time.Minute
+
+// Reissuer issues a replacement certificate and installs it wherever the previous one was used,
+// returning the new PEM-encoded certificate.
+type Reissuer func() ([]byte, error)
+
+// Rotator tracks the expiry of issued certificates and reissues them after a fraction of their lifetime.
+// It implements the controller-runtime Runnable interface.
+type Rotator struct {
+	sync.Mutex
+	recorder record.EventRecorder
+	fraction float64
+	certs    map[string]*trackedCert
+}
+
+type trackedCert struct {
+	// Events regarding the certificate are recorded on this object.
+	object   client.Object
+	reissue  Reissuer
+	notAfter time.Time
+	rotateAt time.Time
+}
+
+// New returns a new *Rotator that reissues certificates after the given fraction of their lifetime.
+// If fraction is not between 0 and 1, DefaultFraction is used.
+func New(recorder record.EventRecorder, fraction float64) *Rotator {
+	if fraction <= 0 || fraction >= 1 {
+		fraction = DefaultFraction
+	}
+	return &Rotator{
+		recorder: recorder,
+		fraction: fraction,
+		certs:    make(map[string]*trackedCert),
+	}
+}
+
+// Track schedules the rotation of a named PEM-encoded certificate, replacing any certificate previously tracked by name.
+// When the certificate is due for rotation, reissue is called to replace it.
+func (r *Rotator) Track(name string, object client.Object, cert []byte, reissue Reissuer) error {
+	notBefore, notAfter, err := validity(cert)
+	if err != nil {
+		return fmt.Errorf("failed to track %s certificate: %w", name, err)
+	}
+	rotateAt := notBefore.Add(time.Duration(float64(notAfter.Sub(notBefore)) * r.fraction))
+
+	r.Lock()
+	r.certs[name] = &trackedCert{object: object, reissue: reissue, notAfter: notAfter, rotateAt: rotateAt}
+	r.Unlock()
+
+	expiryTimestamp.WithLabelValues(name).Set(float64(notAfter.Unix()))
+	rotationTimestamp.WithLabelValues(name).Set(float64(rotateAt.Unix()))
+	logger.Info("Scheduled certificate rotation", "Cert", name, "NotAfter", notAfter, "RotateAt", rotateAt)
+	r.recorder.Eventf(object, corev1.EventTypeNormal, "CertRotationScheduled",
+		"The %s certificate expires at %s and will be reissued at %s",
+		name, notAfter.Format(time.RFC3339), rotateAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// Start checks tracked certificates for rotation until the context is done.
+func (r *Rotator) Start(ctx context.Context) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case now := <-ticker.C:
+			r.rotateDue(now)
+		}
+	}
+}
+
+// rotateDue reissues each tracked certificate that is due for rotation at the given time.
+func (r *Rotator) rotateDue(now time.Time) {
+	r.Lock()
+	due := make(map[string]*trackedCert)
+	for name, tc := range r.certs {
+		if !now.Before(tc.rotateAt) {
+			due[name] = tc
+		}
+	}
+	r.Unlock()
+
+	for name, tc := range due {
+		logger.Info("Reissuing certificate", "Cert", name, "NotAfter", tc.notAfter)
+		cert, err := tc.reissue()
+		if err == nil {
+			err = r.Track(name, tc.object, cert, tc.reissue)
+		}
+		if err != nil {
+			rotationsTotal.WithLabelValues(name, "failure").Inc()
+			logger.Error(err, "Failed to reissue certificate; will reattempt", "Cert", name)
+			r.recorder.Eventf(tc.object, corev1.EventTypeWarning, "CertRotationFailed",
+				"Failed to reissue the %s certificate, which expires at %s: %v", name, tc.notAfter.Format(time.RFC3339), err)
+			continue
+		}
+		rotationsTotal.WithLabelValues(name, "success").Inc()
+		r.recorder.Eventf(tc.object, corev1.EventTypeNormal, "CertRotated", "Reissued the %s certificate", name)
+	}
+}
+
+// validity returns the validity period of the first certificate in a PEM-encoded chain.
+func validity(cert []byte) (time.Time, time.Time, error) {
+	block, _ := pem.Decode(cert)
+	if block == nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("failed to decode PEM block")
+	}
+	c, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return c.NotBefore, c.NotAfter, nil
+}
@@ -0,0 +1,98 @@
+package certrotation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestRotateDue(t *testing.T) {
+	notBefore := time.Now().Add(-time.Hour)
+	notAfter := notBefore.Add(3 * time.Hour)
+
+	recorder := record.NewFakeRecorder(10)
+	r := New(recorder, 2.0/3.0)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "gm-webhook-cert", Namespace: "gm-operator"}}
+
+	reissued := 0
+	reissue := func() ([]byte, error) {
+		reissued++
+		if reissued == 1 {
+			return nil, fmt.Errorf("signer unavailable")
+		}
+		return mkCert(t, time.Now(), time.Now().Add(3*time.Hour)), nil
+	}
+	if err := r.Track("webhook", secret, mkCert(t, notBefore, notAfter), reissue); err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, recorder, "CertRotationScheduled")
+
+	// Not yet two thirds of the way through the certificate's lifetime.
+	r.rotateDue(notBefore.Add(time.Hour))
+	if reissued != 0 {
+		t.Fatalf("expected no rotation, got %d", reissued)
+	}
+
+	r.rotateDue(notBefore.Add(2 * time.Hour))
+	if reissued != 1 {
+		t.Fatalf("expected a rotation attempt, got %d", reissued)
+	}
+	expectEvent(t, recorder, "CertRotationFailed")
+
+	// Failures are retried at the next check.
+	r.rotateDue(notBefore.Add(2*time.Hour + checkInterval))
+	if reissued != 2 {
+		t.Fatalf("expected a second rotation attempt, got %d", reissued)
+	}
+	expectEvent(t, recorder, "CertRotationScheduled")
+	expectEvent(t, recorder, "CertRotated")
+
+	// The reissued certificate is scheduled for rotation two hours from now.
+	r.rotateDue(time.Now().Add(time.Hour))
+	if reissued != 2 {
+		t.Fatalf("expected the reissued certificate not to be rotated, got %d", reissued)
+	}
+}
+
+func expectEvent(t *testing.T, recorder *record.FakeRecorder, reason string) {
+	t.Helper()
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, reason) {
+			t.Fatalf("expected %s event, got %q", reason, e)
+		}
+	default:
+		t.Fatalf("expected %s event", reason)
+	}
+}
+
+func mkCert(t *testing.T, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "admission"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
@@ -0,0 +1,139 @@
+package cfsslsrv
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/cloudflare/cfssl/csr"
+	"github.com/cloudflare/cfssl/initca"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// CertificateAuthority supplies the root CA and CA key that the CFSSLServer signs certificates with.
+type CertificateAuthority interface {
+	// Load returns a PEM-encoded CA and CA key.
+	Load(ctx context.Context) (ca, caKey []byte, err error)
+}
+
+// GeneratedCA is a CertificateAuthority that generates a new root CA each time it is loaded.
+type GeneratedCA struct{}
+
+// Load implements CertificateAuthority.
+func (GeneratedCA) Load(context.Context) ([]byte, []byte, error) {
+	logger.Info("Initializing CA", "CN", "Grey Matter Root CA")
+	return generateCA()
+}
+
+// PersistedCA is a CertificateAuthority that generates a root CA the first time it is loaded
+// and stores it in a Secret, so that the same CA is reused when the operator restarts.
+type PersistedCA struct {
+	Client    client.Client
+	Namespace string
+	Name      string
+}
+
+// Load implements CertificateAuthority.
+func (p PersistedCA) Load(ctx context.Context) ([]byte, []byte, error) {
+	ca, caKey, err := readSecretCA(ctx, p.Client, p.Namespace, p.Name)
+	if err == nil {
+		logger.Info("Using persisted CA", "Secret", p.Namespace+"/"+p.Name)
+		return ca, caKey, nil
+	}
+	if !errors.IsNotFound(err) {
+		return nil, nil, err
+	}
+
+	logger.Info("Persisted CA not found; initializing CA", "CN", "Grey Matter Root CA", "Secret", p.Namespace+"/"+p.Name)
+	ca, caKey, err = generateCA()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: p.Name, Namespace: p.Namespace},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       ca,
+			corev1.TLSPrivateKeyKey: caKey,
+		},
+	}
+	if err := p.Client.Create(ctx, secret); err != nil {
+		// Another operator instance persisted a CA first, so use theirs.
+		if errors.IsAlreadyExists(err) {
+			return readSecretCA(ctx, p.Client, p.Namespace, p.Name)
+		}
+		return nil, nil, fmt.Errorf("failed to persist CA in secret %s/%s: %w", p.Namespace, p.Name, err)
+	}
+
+	return ca, caKey, nil
+}
+
+// SecretCA is a CertificateAuthority that reads a user-supplied CA from a kubernetes.io/tls Secret.
+type SecretCA struct {
+	Client    client.Client
+	Namespace string
+	Name      string
+}
+
+// Load implements CertificateAuthority.
+func (s SecretCA) Load(ctx context.Context) ([]byte, []byte, error) {
+	ca, caKey, err := readSecretCA(ctx, s.Client, s.Namespace, s.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.Info("Using provided CA", "Secret", s.Namespace+"/"+s.Name)
+	return ca, caKey, nil
+}
+
+// FileCA is a CertificateAuthority that reads a CA and CA key from files, e.g. mounted from a volume.
+type FileCA struct {
+	CertPath string
+	KeyPath  string
+}
+
+// Load implements CertificateAuthority.
+func (f FileCA) Load(context.Context) ([]byte, []byte, error) {
+	ca, err := os.ReadFile(f.CertPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA: %w", err)
+	}
+	caKey, err := os.ReadFile(f.KeyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	logger.Info("Using provided CA", "File", f.CertPath)
+	return ca, caKey, nil
+}
+
+func readSecretCA(ctx context.Context, c client.Client, namespace, name string) ([]byte, []byte, error) {
+	secret := &corev1.Secret{}
+	if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, secret); err != nil {
+		return nil, nil, err
+	}
+	ca, caKey := secret.Data[corev1.TLSCertKey], secret.Data[corev1.TLSPrivateKeyKey]
+	if len(ca) == 0 || len(caKey) == 0 {
+		return nil, nil, fmt.Errorf("secret %s/%s must contain %s and %s", namespace, name, corev1.TLSCertKey, corev1.TLSPrivateKeyKey)
+	}
+	return ca, caKey, nil
+}
+
+func generateCA() ([]byte, []byte, error) {
+	ca, _, caKey, err := initca.New(&csr.CertificateRequest{
+		CN:         "Grey Matter Root CA",
+		KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
+		Names: []csr.Name{
+			{C: "US", ST: "VA", L: "Alexandria", O: "Grey Matter"},
+		},
+		Hosts: []string{"greymatter.io"},
+		CA: &csr.CAConfig{
+			Expiry:     "8760h",
+			PathLength: 2,
+		},
+	})
+	return ca, caKey, err
+}
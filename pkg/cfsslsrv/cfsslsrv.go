@@ -17,7 +17,6 @@ import (
 	"github.com/cloudflare/cfssl/config"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/helpers"
-	"github.com/cloudflare/cfssl/initca"
 	"github.com/cloudflare/cfssl/log"
 	ocspconfig "github.com/cloudflare/cfssl/ocsp/config"
 	"github.com/go-logr/logr"
@@ -41,35 +40,35 @@ type CFSSLServer struct {
 // It takes an optional PEM-encoded CA and CA key used by the server.
 // If a CA and CA key are not provided, they will be generated and used to launch the server.
 func New(ca, caKey []byte) (*CFSSLServer, error) {
+	if len(ca) == 0 || len(caKey) == 0 {
+		return NewFromAuthority(context.Background(), GeneratedCA{})
+	}
 
-	// Wrap CFSSL's logger in our custom implementation
-	log.SetLogger(&cfsslLogger{logger})
-	log.Level = log.LevelInfo
-
-	var err error
+	setLogger()
+	logger.Info("Using provided CA and CA key")
+	return newServer(ca, caKey)
+}
 
-	if len(ca) == 0 || len(caKey) == 0 {
-		logger.Info("CA and CA key not provided; initializing CA", "CN", "Grey Matter Root CA")
-		ca, _, caKey, err = initca.New(&csr.CertificateRequest{
-			CN:         "Grey Matter Root CA",
-			KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
-			Names: []csr.Name{
-				{C: "US", ST: "VA", L: "Alexandria", O: "Grey Matter"},
-			},
-			Hosts: []string{"greymatter.io"},
-			CA: &csr.CAConfig{
-				Expiry:     "8760h",
-				PathLength: 2,
-			},
-		})
-		if err != nil {
-			return nil, err
-		}
+// NewFromAuthority constructs a CFSSLServer instance that signs certificates with the CA loaded from a CertificateAuthority.
+func NewFromAuthority(ctx context.Context, authority CertificateAuthority) (*CFSSLServer, error) {
+	setLogger()
 
-	} else {
-		logger.Info("Using provided CA and CA key")
+	ca, caKey, err := authority.Load(ctx)
+	if err != nil {
+		logger.Error(err, "Failed to load CA")
+		return nil, err
 	}
 
+	return newServer(ca, caKey)
+}
+
+func setLogger() {
+	// Wrap CFSSL's logger in our custom implementation
+	log.SetLogger(&cfsslLogger{logger})
+	log.Level = log.LevelInfo
+}
+
+func newServer(ca, caKey []byte) (*CFSSLServer, error) {
 	if _, err := helpers.ParseCertificatesPEM(ca); err != nil {
 		err = fmt.Errorf("failed to decode PEM block")
 		logger.Error(err, "Detected invalid CA")
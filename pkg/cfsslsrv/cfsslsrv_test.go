@@ -1,12 +1,15 @@
 package cfsslsrv
 
 import (
+	"bytes"
+	"context"
 	"crypto/x509"
 	"testing"
 
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/cloudflare/cfssl/helpers"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -84,3 +87,33 @@ func TestCFSSL(t *testing.T) {
 		t.Fatal("failed to verify cert", err)
 	}
 }
+
+func TestPersistedCA(t *testing.T) {
+	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
+
+	c := fake.NewClientBuilder().Build()
+	p := PersistedCA{Client: c, Namespace: "gm-operator", Name: "gm-operator-ca"}
+
+	ca, caKey, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second load, as on operator restart, should return the same CA rather than a new one.
+	reloadedCA, reloadedCAKey, err := p.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ca, reloadedCA) || !bytes.Equal(caKey, reloadedCAKey) {
+		t.Fatal("expected the persisted CA to be reloaded")
+	}
+
+	// The persisted Secret can also be supplied as a user-provided CA.
+	secretCA, _, err := SecretCA{Client: c, Namespace: "gm-operator", Name: "gm-operator-ca"}.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ca, secretCA) {
+		t.Fatal("expected SecretCA to load the same CA")
+	}
+}
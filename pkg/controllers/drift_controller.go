@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/mesh_install"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// DriftCorrectedObjects returns an object of each kind of core manifest that is watched for drift.
+// Only objects labeled with wellknown.LABEL_MESH need to be cached for them.
+func DriftCorrectedObjects() []client.Object {
+	return []client.Object{
+		&appsv1.Deployment{},
+		&appsv1.StatefulSet{},
+		&appsv1.DaemonSet{},
+		&corev1.Service{},
+		&corev1.ServiceAccount{},
+	}
+}
+
+// DriftReconciler re-converges the core manifests of the applied Mesh when the objects it owns
+// are changed or deleted outside of the CUE, e.g. by hand edits.
+type DriftReconciler struct {
+	client.Client
+	*mesh_install.Installer
+}
+
+// SetupWithManager registers the DriftReconciler with a controller-runtime manager.
+func (r *DriftReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Changes to the Mesh itself are handled by the MeshReconciler.
+	never := predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc:  func(event.UpdateEvent) bool { return false },
+	}
+	// Ignore status updates of objects that have a generation, e.g. a Deployment's rollout progress.
+	specChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			if e.ObjectNew.GetGeneration() == 0 {
+				return e.ObjectOld.GetResourceVersion() != e.ObjectNew.GetResourceVersion()
+			}
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration()
+		},
+	}
+	// Core manifests are applied with the Mesh as a (non-controller) owner.
+	toOwner := &handler.EnqueueRequestForOwner{OwnerType: &v1alpha1.Mesh{}}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named("drift").
+		For(&v1alpha1.Mesh{}, builder.WithPredicates(never))
+	for _, obj := range DriftCorrectedObjects() {
+		b = b.Watches(&source.Kind{Type: obj}, toOwner, builder.WithPredicates(specChanged))
+	}
+	return b.Complete(r)
+}
+
+// Reconcile implements reconcile.Reconciler.
+func (r *DriftReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	select {
+	case <-r.Ready():
+	default:
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	mesh := &v1alpha1.Mesh{}
+	if err := r.Get(ctx, req.NamespacedName, mesh); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	// Only correct a Mesh that has been applied and is not being torn down.
+	applied := r.AppliedMesh(mesh.Name)
+	if applied == nil || applied.UID != mesh.UID || !mesh.DeletionTimestamp.IsZero() || r.DryRun {
+		return ctrl.Result{}, nil
+	}
+
+	// The returned error is logged by controller-runtime before the request is requeued.
+	return ctrl.Result{}, r.CorrectDrift(mesh)
+}
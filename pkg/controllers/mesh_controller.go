@@ -0,0 +1,142 @@
+// Package controllers defines reconcilers that drive cluster state from Grey Matter custom resources.
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/mesh_install"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+var (
+	logger = ctrl.Log.WithName("controllers")
+)
+
+// MeshReconciler installs, updates, and removes Grey Matter core components and dependencies
+// according to the observed state of Mesh custom resources.
+type MeshReconciler struct {
+	client.Client
+	*mesh_install.Installer
+}
+
+// SetupWithManager registers the MeshReconciler with a controller-runtime manager.
+func (r *MeshReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Marking a Mesh with finalizers for deletion doesn't necessarily change its generation.
+	deletionRequested := predicate.Funcs{
+		CreateFunc:  func(event.CreateEvent) bool { return false },
+		DeleteFunc:  func(event.DeleteEvent) bool { return false },
+		GenericFunc: func(event.GenericEvent) bool { return false },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetDeletionTimestamp().IsZero() && !e.ObjectNew.GetDeletionTimestamp().IsZero()
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		// Status updates do not change a Mesh's generation, so they won't trigger another reconcile.
+		For(&v1alpha1.Mesh{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, deletionRequested))).
+		// Requests from the Installer for re-convergence when a Mesh's spec has not changed.
+		Watches(&source.Channel{Source: r.ReconcileRequests()}, &handler.EnqueueRequestForObject{}).
+		Complete(r)
+}
+
+// Reconcile implements reconcile.Reconciler.
+// Returning an error requeues the request with exponential backoff.
+func (r *MeshReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	// The Installer needs the operator's image pull secret and Mesh CRD before it can apply anything.
+	select {
+	case <-r.Ready():
+	default:
+		logger.Info("Installer not yet started; will reattempt in 10 seconds", "Mesh", req.Name)
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	applied := r.AppliedMesh(req.Name)
+
+	mesh := &v1alpha1.Mesh{}
+	if err := r.Get(ctx, req.NamespacedName, mesh); err != nil {
+		if !errors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		// The Mesh is gone without having been torn down (e.g. its finalizer was removed by hand);
+		// drop our references to it if we applied it.
+		if applied != nil {
+			r.ForgetMesh(applied)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if !mesh.DeletionTimestamp.IsZero() {
+		return r.teardown(ctx, mesh)
+	}
+
+	// Ensure we get the chance to tear the Mesh down before it is deleted.
+	// A dry run doesn't install anything, so there is nothing to tear down.
+	if !controllerutil.ContainsFinalizer(mesh, wellknown.FINALIZER_MESH_CLEANUP) && !r.DryRun {
+		controllerutil.AddFinalizer(mesh, wellknown.FINALIZER_MESH_CLEANUP)
+		if err := r.Update(ctx, mesh); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Treat the Mesh as an update only if it's the same object we've already applied.
+	// Otherwise (e.g. after the operator restarts) it is installed from scratch.
+	var prev *v1alpha1.Mesh
+	if applied != nil && applied.UID == mesh.UID {
+		prev = applied
+	}
+
+	// The returned error is logged by controller-runtime before the request is requeued.
+	if err := r.ApplyMesh(prev, mesh); err != nil {
+		// Check on a rollout in progress again later, without backing off.
+		if mesh_install.IsRolloutInProgress(err) {
+			logger.Info("Mesh rollout in progress", "Mesh", mesh.Name, "Status", err.Error())
+			return ctrl.Result{RequeueAfter: mesh_install.RolloutCheckInterval}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// teardown removes a deleted Mesh's components and configuration, and releases its finalizer once nothing is left.
+// Leftovers are reported in the Mesh's status and retried periodically.
+func (r *MeshReconciler) teardown(ctx context.Context, mesh *v1alpha1.Mesh) (ctrl.Result, error) {
+	if !controllerutil.ContainsFinalizer(mesh, wellknown.FINALIZER_MESH_CLEANUP) {
+		return ctrl.Result{}, nil
+	}
+
+	// A finalizer left by an earlier run is kept, since a dry run must not remove anything.
+	if r.DryRun {
+		logger.Info("Dry run; not tearing down Mesh", "Mesh", mesh.Name)
+		return ctrl.Result{}, nil
+	}
+
+	leftovers := r.RemoveMesh(mesh)
+	r.RecordTeardownResult(mesh, leftovers)
+	if len(leftovers) > 0 {
+		logger.Info("Mesh teardown incomplete; will reattempt in 30 seconds", "Mesh", mesh.Name, "Leftovers", leftovers)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	// Recording the teardown result patched the Mesh's status, so patch rather than update the stale object.
+	patch := client.MergeFrom(mesh.DeepCopy())
+	controllerutil.RemoveFinalizer(mesh, wellknown.FINALIZER_MESH_CLEANUP)
+	if err := r.Patch(ctx, mesh, patch); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	logger.Info("Mesh removed", "Mesh", mesh.Name)
+
+	return ctrl.Result{}, nil
+}
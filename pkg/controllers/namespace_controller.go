@@ -0,0 +1,53 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/greymatter-io/operator/pkg/mesh_install"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// NamespaceReconciler has namespaces join or leave the Meshes whose watch_namespace_selector
+// selects them as their labels change.
+type NamespaceReconciler struct {
+	client.Client
+	*mesh_install.Installer
+}
+
+// SetupWithManager registers the NamespaceReconciler with a controller-runtime manager.
+func (r *NamespaceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	// Only label changes and deletion affect whether a namespace is selected.
+	labelsChanged := predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return !reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels()) ||
+				e.ObjectOld.GetDeletionTimestamp().IsZero() != e.ObjectNew.GetDeletionTimestamp().IsZero()
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Namespace{}, builder.WithPredicates(labelsChanged)).
+		Complete(r)
+}
+
+// Reconcile implements reconcile.Reconciler.
+func (r *NamespaceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	select {
+	case <-r.Ready():
+	default:
+		return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+	}
+
+	if err := r.ReconcileNamespace(req.Name); err != nil {
+		logger.Error(err, "failed to reconcile namespace membership; will retry", "Namespace", req.Name)
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
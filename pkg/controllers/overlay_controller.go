@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/mesh_install"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// overlaySource identifies the overlays read from ConfigMaps in cuemodule.Overlays.
+const overlaySource = "configmaps"
+
+// OverlayReconciler unifies CUE fragments from ConfigMaps labeled with wellknown.LABEL_CUE_OVERLAY
+// on top of the operator CUE, and reapplies the Mesh whenever they change.
+// The label's value names the outputs the fragments target: k8s or gm.
+// Each key ending in .cue is a fragment; fragments are unified in order of ConfigMap name and then key.
+type OverlayReconciler struct {
+	client.Client
+	*mesh_install.Installer
+	Recorder  record.EventRecorder
+	Namespace string
+}
+
+// SetupWithManager registers the OverlayReconciler with a controller-runtime manager.
+func (r *OverlayReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	inNamespace := predicate.NewPredicateFuncs(func(obj client.Object) bool {
+		return obj.GetNamespace() == r.Namespace
+	})
+	// Removing the label from a ConfigMap must also remove its overlays.
+	labeled := predicate.Funcs{
+		CreateFunc:  func(e event.CreateEvent) bool { return hasOverlayLabel(e.Object) },
+		DeleteFunc:  func(e event.DeleteEvent) bool { return hasOverlayLabel(e.Object) },
+		GenericFunc: func(e event.GenericEvent) bool { return hasOverlayLabel(e.Object) },
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return hasOverlayLabel(e.ObjectOld) || hasOverlayLabel(e.ObjectNew)
+		},
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("cue-overlays").
+		For(&corev1.ConfigMap{}, builder.WithPredicates(inNamespace, labeled)).
+		Complete(r)
+}
+
+func hasOverlayLabel(obj client.Object) bool {
+	_, ok := obj.GetLabels()[wellknown.LABEL_CUE_OVERLAY]
+	return ok
+}
+
+// Reconcile implements reconcile.Reconciler.
+// Since overlays from every ConfigMap are unified together, each request re-reads all of them.
+func (r *OverlayReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.List(ctx, configMaps, client.InNamespace(r.Namespace), client.HasLabels{wellknown.LABEL_CUE_OVERLAY}); err != nil {
+		return ctrl.Result{}, err
+	}
+	sort.Slice(configMaps.Items, func(a, b int) bool {
+		return configMaps.Items[a].Name < configMaps.Items[b].Name
+	})
+
+	var overlays []cuemodule.Overlay
+	sources := make(map[string]*corev1.ConfigMap)
+	for idx := range configMaps.Items {
+		cm := &configMaps.Items[idx]
+		keys := make([]string, 0, len(cm.Data))
+		for key := range cm.Data {
+			if strings.HasSuffix(key, ".cue") {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			name := fmt.Sprintf("configmap/%s/%s", cm.Name, key)
+			overlays = append(overlays, cuemodule.Overlay{
+				Name:   name,
+				Target: cm.Labels[wellknown.LABEL_CUE_OVERLAY],
+				CUE:    cm.Data[key],
+			})
+			sources[name] = cm
+		}
+	}
+
+	// Keep the current overlays if the new ones can't be unified with the operator CUE.
+	if _, _, err := cuemodule.LoadAll(r.CueRoot, r.Overlays.With(overlaySource, overlays)...); err != nil {
+		var overlayErr *cuemodule.OverlayError
+		if errors.As(err, &overlayErr) {
+			if cm, ok := sources[overlayErr.Overlay.Name]; ok {
+				r.Recorder.Event(cm, corev1.EventTypeWarning, "OverlayConflict", overlayErr.Error())
+			}
+		}
+		logger.Error(err, "CUE overlays rejected; keeping the previous overlays")
+		return ctrl.Result{}, nil
+	}
+
+	r.Overlays.Set(overlaySource, overlays)
+	logger.Info("CUE overlays updated. Reapplying configuration...", "Overlays", len(overlays))
+	for _, cm := range configMaps.Items {
+		if cm.Name == req.Name {
+			r.Recorder.Event(&cm, corev1.EventTypeNormal, "OverlayApplied", "CUE overlays were unified with the operator CUE")
+		}
+	}
+
+	return ctrl.Result{}, r.Reapply()
+}
@@ -3,6 +3,7 @@ package cuemodule
 import (
 	"bytes"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"strings"
 
@@ -73,8 +74,16 @@ func Extract(v cue.Value, s interface{}) error {
 }
 
 // LogError logs errors that may or may not contain a list of cue/errors.Error.
-// If the error provided is not a cue/errors.Error, a plain error is logged.
+// Each CUE error is logged with its position; if the error provided is not a CUE error, a plain error is logged.
 func LogError(logger logr.Logger, err error) {
+	var e *Error
+	if goerrors.As(err, &e) {
+		for _, d := range e.Details {
+			logger.Error(goerrors.New(d.Message), "failed to "+e.Op, "File", d.File, "Line", d.Line, "Column", d.Column, "Path", d.Path)
+		}
+		return
+	}
+
 	switch v := err.(type) {
 	case errors.Error:
 		for _, e := range errors.Errors(v) {
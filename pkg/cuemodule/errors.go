@@ -0,0 +1,93 @@
+package cuemodule
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	cueerrors "cuelang.org/go/cue/errors"
+)
+
+// Error reports a failure to load, unify, or extract the operator CUE,
+// listing each underlying CUE error with its position and path.
+type Error struct {
+	// What was being done when the errors occurred, e.g. "load CUE module".
+	Op      string
+	Details []ErrorDetail
+
+	err error
+}
+
+// ErrorDetail is a single CUE error.
+type ErrorDetail struct {
+	// The position of the error in CUE source, if known.
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+	// The path of the field in error, e.g. mesh.spec.install_namespace.
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (d ErrorDetail) String() string {
+	var b strings.Builder
+	if d.File != "" {
+		fmt.Fprintf(&b, "%s:%d:%d: ", d.File, d.Line, d.Column)
+	}
+	if d.Path != "" {
+		fmt.Fprintf(&b, "%s: ", d.Path)
+	}
+	b.WriteString(d.Message)
+	return b.String()
+}
+
+func (e *Error) Error() string {
+	if len(e.Details) == 1 {
+		return fmt.Sprintf("failed to %s: %s", e.Op, e.Details[0])
+	}
+	lines := make([]string, len(e.Details))
+	for i, d := range e.Details {
+		lines[i] = "  " + d.String()
+	}
+	return fmt.Sprintf("failed to %s: %d errors:\n%s", e.Op, len(e.Details), strings.Join(lines, "\n"))
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+// newError wraps err as an *Error, or returns nil if err is nil.
+// Errors that are already an *Error are returned as is.
+func newError(op string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	e = &Error{Op: op, err: err}
+	for _, ce := range cueerrors.Errors(err) {
+		format, args := ce.Msg()
+		d := ErrorDetail{
+			Path:    strings.Join(ce.Path(), "."),
+			Message: fmt.Sprintf(format, args...),
+		}
+		if d.Message == "" {
+			d.Message = ce.Error()
+		}
+		// Conflicts have no primary position, but report the positions of the conflicting values.
+		pos := ce.Position()
+		if !pos.IsValid() {
+			if positions := cueerrors.Positions(ce); len(positions) > 0 {
+				pos = positions[0]
+			}
+		}
+		if pos.IsValid() {
+			d.File, d.Line, d.Column = pos.Filename(), pos.Line(), pos.Column()
+		}
+		e.Details = append(e.Details, d)
+	}
+	return e
+}
@@ -0,0 +1,43 @@
+package cuemodule
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestNewError(t *testing.T) {
+	v := cuecontext.New().CompileString(`
+mesh: spec: install_namespace: "greymatter"
+mesh: spec: install_namespace: "other"
+`, cue.Filename("mesh.cue"))
+	err := newError("load k8s/outputs", v.Validate())
+
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an *Error, got %v", err)
+	}
+	if len(e.Details) != 1 {
+		t.Fatalf("expected 1 error, got %d: %v", len(e.Details), e)
+	}
+	d := e.Details[0]
+	if d.File != "mesh.cue" || d.Line == 0 || d.Column == 0 {
+		t.Errorf("expected a position in mesh.cue, got %s:%d:%d", d.File, d.Line, d.Column)
+	}
+	if d.Path != "mesh.spec.install_namespace" {
+		t.Errorf("expected path mesh.spec.install_namespace, got %q", d.Path)
+	}
+	if !strings.HasPrefix(err.Error(), "failed to load k8s/outputs: mesh.cue:") {
+		t.Errorf("unexpected message %q", err)
+	}
+
+	if wrapped := newError("extract mesh", err); wrapped != err {
+		t.Errorf("expected an *Error to be returned as is, got %v", wrapped)
+	}
+	if newError("extract mesh", nil) != nil {
+		t.Error("expected nil for a nil error")
+	}
+}
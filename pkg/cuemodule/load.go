@@ -7,20 +7,30 @@ import (
 	"cuelang.org/go/cue"
 	"cuelang.org/go/cue/cuecontext"
 	"cuelang.org/go/cue/load"
-	"errors"
 	"github.com/greymatter-io/operator/api/v1alpha1"
-	opnshftsec "github.com/openshift/api/security/v1"
-	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	rbacv1 "k8s.io/api/rbac/v1"
+	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var (
 	logger = ctrl.Log.WithName("cuemodule")
+
+	// The kinds of k8s manifests that are typed when extracted. Others are extracted as unstructured objects.
+	scheme = runtime.NewScheme()
 )
 
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(extv1.AddToScheme(scheme))
+	utilruntime.Must(v1alpha1.AddToScheme(scheme))
+}
+
 // OperatorCUE holds the two top-level cue.Values that configure the operator,
 // according to the major split between K8s and GM configuration
 type OperatorCUE struct {
@@ -31,8 +41,9 @@ type OperatorCUE struct {
 	GM cue.Value
 }
 
-// LoadAll loads the provided CUE for configuring the operator into an OperatorCUE and a Mesh
-func LoadAll(cuemoduleRoot string) (*OperatorCUE, *v1alpha1.Mesh, error) {
+// LoadAll loads the provided CUE for configuring the operator into an OperatorCUE and a Mesh,
+// unifying any overlays on top of it. Failures are reported as an *Error, or an *OverlayError for an overlay that cannot be unified.
+func LoadAll(cuemoduleRoot string, overlays ...Overlay) (*OperatorCUE, *v1alpha1.Mesh, error) {
 	//cwd, _ := os.Getwd()
 	allCUEInstances := load.Instances([]string{
 		"./k8s/outputs",
@@ -44,9 +55,12 @@ func LoadAll(cuemoduleRoot string) (*OperatorCUE, *v1alpha1.Mesh, error) {
 	operatorCUE.K8s = cuecontext.New().BuildInstance(allCUEInstances[0])
 	operatorCUE.GM = cuecontext.New().BuildInstance(allCUEInstances[1])
 	if err := operatorCUE.K8s.Err(); err != nil {
-		return nil, nil, err
+		return nil, nil, newError("load k8s/outputs", err)
 	}
 	if err := operatorCUE.GM.Err(); err != nil {
+		return nil, nil, newError("load gm/outputs", err)
+	}
+	if err := operatorCUE.applyOverlays(overlays); err != nil {
 		return nil, nil, err
 	}
 
@@ -57,11 +71,38 @@ func LoadAll(cuemoduleRoot string) (*OperatorCUE, *v1alpha1.Mesh, error) {
 
 	err := Extract(operatorCUE.K8s, &extracted)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, newError("extract mesh", err)
 	}
 	return operatorCUE, &extracted.Mesh, nil
 }
 
+// DryRun loads the CUE at cuemoduleRoot with any overlays and extracts everything the operator would use from it
+// (operator config, K8s manifests, mesh configs, and sidecar templates) without applying anything,
+// returning the first error encountered.
+func DryRun(cuemoduleRoot string, overlays ...Overlay) error {
+	operatorCUE, mesh, err := LoadAll(cuemoduleRoot, overlays...)
+	if err != nil {
+		return err
+	}
+	if _, _, err := operatorCUE.ExtractConfig(); err != nil {
+		return err
+	}
+	if err := operatorCUE.UnifyWithMesh(mesh); err != nil {
+		return err
+	}
+	if _, err := operatorCUE.ExtractCoreK8sManifests(); err != nil {
+		return err
+	}
+	if _, _, err := operatorCUE.ExtractCoreMeshConfigs(); err != nil {
+		return err
+	}
+	if _, _, err := operatorCUE.UnifyAndExtractSidecar("dry-run", SidecarOverrides{}); err != nil {
+		return err
+	}
+	_, _, err = operatorCUE.UnifyAndExtractSidecarConfig("dry-run", 8080)
+	return err
+}
+
 // Config represents the `config` struct from the operator CUE in inputs.cue
 type Config struct {
 	// Flags
@@ -79,7 +120,7 @@ type Defaults struct {
 
 // ExtractConfig pulls the values from the CUE into the Config struct in Go
 // for use in various places in the operator
-func (operatorCUE *OperatorCUE) ExtractConfig() (Config, Defaults) {
+func (operatorCUE *OperatorCUE) ExtractConfig() (Config, Defaults, error) {
 	var extracted struct {
 		Config   Config   `json:"config"`
 		Defaults Defaults `json:"defaults"`
@@ -87,13 +128,13 @@ func (operatorCUE *OperatorCUE) ExtractConfig() (Config, Defaults) {
 
 	err := Extract(operatorCUE.K8s, &extracted)
 	if err != nil {
-		panic(err)
+		return Config{}, Defaults{}, newError("extract operator config", err)
 	}
 
-	return extracted.Config, extracted.Defaults
+	return extracted.Config, extracted.Defaults, nil
 }
 
-// TODO who should be responsible for logging errors - these, or the calling functions? I've been inconsistent about it
+// CUE errors returned by the following methods are reported as an *Error, and are left to the caller to log (see LogError).
 
 // UnifyWithMesh unifies the operatorCUE with a Mesh CR to fill in values
 func (operatorCUE *OperatorCUE) UnifyWithMesh(mesh *v1alpha1.Mesh) error {
@@ -103,22 +144,12 @@ func (operatorCUE *OperatorCUE) UnifyWithMesh(mesh *v1alpha1.Mesh) error {
 	}
 	k8sManifestsValue := operatorCUE.K8s.Unify(meshValue)
 	if err := k8sManifestsValue.Err(); err != nil {
-		logger.Error(err,
-			"Error while attempting to unify provided Mesh resource with Kubernetes mesh configs CUE",
-			"GM CUE", operatorCUE.K8s,
-			"Mesh Value", meshValue,
-			"Unification Result", k8sManifestsValue)
-		return err
+		return newError(fmt.Sprintf("unify Mesh %s with k8s/outputs", mesh.Name), err)
 	}
 	// We're also going to do unification with the GM CUE and cache it, as an optimization
 	meshConfigsValue := operatorCUE.GM.Unify(meshValue)
 	if err := meshConfigsValue.Err(); err != nil {
-		logger.Error(err,
-			"Error while attempting to unify provided Mesh resource with Grey Matter mesh configs CUE",
-			"GM CUE", operatorCUE.GM,
-			"Mesh Value", meshValue,
-			"Unification Result", meshConfigsValue)
-		return err
+		return newError(fmt.Sprintf("unify Mesh %s with gm/outputs", mesh.Name), err)
 	}
 	operatorCUE.K8s = k8sManifestsValue
 	operatorCUE.GM = meshConfigsValue
@@ -132,12 +163,7 @@ func (operatorCUE *OperatorCUE) TempGMValueUnifiedWithDefaults(defaults Defaults
 	}
 	meshConfigsValue := operatorCUE.GM.Unify(defaultsValue)
 	if err := meshConfigsValue.Err(); err != nil {
-		logger.Error(err,
-			"Error while attempting to unify provided Defaults resource with Grey Matter mesh configs CUE",
-			"GM CUE", operatorCUE.GM,
-			"Defaults Value", defaultsValue,
-			"Unification Result", meshConfigsValue)
-		return OperatorCUE{}, err
+		return OperatorCUE{}, newError("unify defaults with gm/outputs", err)
 	}
 	return OperatorCUE{GM: meshConfigsValue, K8s: operatorCUE.K8s}, nil
 }
@@ -151,14 +177,12 @@ func (operatorCUE *OperatorCUE) ExtractCoreK8sManifests() (manifestObjects []cli
 	var extracted struct {
 		K8sManifests []json.RawMessage `json:"k8s_manifests"`
 	}
-	// TODO handle extraction error by exploding loudly
 	err = Extract(operatorCUE.K8s, &extracted)
 	if err != nil {
-		return nil, err
+		return nil, newError("extract k8s manifests", err)
 	}
 
-	manifestObjects = ExtractAndTypeK8sManifestObjects(extracted.K8sManifests)
-	return manifestObjects, nil
+	return ExtractAndTypeK8sManifestObjects(extracted.K8sManifests)
 }
 
 // Mesh Configs
@@ -168,10 +192,9 @@ func (operatorCUE *OperatorCUE) ExtractCoreMeshConfigs() (meshConfigs []json.Raw
 	var extracted struct {
 		MeshConfigs []json.RawMessage `json:"mesh_configs"`
 	}
-	// TODO handle extraction error
 	err = Extract(operatorCUE.GM, &extracted)
 	if err != nil {
-		return nil, nil, err // TODO error context?
+		return nil, nil, newError("extract mesh configs", err)
 	}
 	kinds = IdentifyGMConfigObjects(extracted.MeshConfigs)
 	return extracted.MeshConfigs, kinds, nil
@@ -179,25 +202,26 @@ func (operatorCUE *OperatorCUE) ExtractCoreMeshConfigs() (meshConfigs []json.Raw
 
 // Deployment assist sidecar K8s and GM
 
-// UnifyAndExtractSidecar unifies the cluster meant for a deployment with the CUE for a to-be-injected sidecar,
-// and extracts the K8s manifest components to be injected
-func (operatorCUE *OperatorCUE) UnifyAndExtractSidecar(clusterLabel string) (container corev1.Container, volumes []corev1.Volume, err error) {
+// UnifyAndExtractSidecar unifies the cluster meant for a deployment and its sidecar overrides with the CUE for a
+// to-be-injected sidecar, and extracts the K8s manifest components to be injected.
+// Overrides are unified as sidecar_container fields (cpu, memory, image, log_level, and extra_ports),
+// leaving it to the CUE to set them on the container's resources, image, env, and ports.
+func (operatorCUE *OperatorCUE) UnifyAndExtractSidecar(clusterLabel string, overrides SidecarOverrides) (container corev1.Container, volumes []corev1.Volume, err error) {
 	// By this point, we can assume GM has *already* been unified with THE mesh that this operator manages,
 	// when the mesh was created.
 
-	// Unify with name
+	// Unify with name and overrides
 	injectName := struct {
 		Name string `json:"name"`
-	}{Name: clusterLabel}
-	withSidecarName, _ := FromStruct("sidecar_container", injectName)
+		SidecarOverrides
+	}{Name: clusterLabel, SidecarOverrides: overrides}
+	withSidecarName, err := FromStruct("sidecar_container", injectName)
+	if err != nil {
+		return container, volumes, newError(fmt.Sprintf("encode sidecar overrides for %s", clusterLabel), err)
+	}
 	unifiedValue := operatorCUE.K8s.Unify(withSidecarName) // bit overkill, but it shouldn't matter
 	if err := unifiedValue.Err(); err != nil {
-		logger.Error(err,
-			"Error while attempting to unify provided name with Grey Matter K8s CUE",
-			"K8s CUE", operatorCUE.K8s,
-			"Struct with sidecar name", withSidecarName,
-			"Unification Result", unifiedValue)
-		return container, volumes, err
+		return container, volumes, newError(fmt.Sprintf("unify sidecar %s with k8s/outputs", clusterLabel), err)
 	}
 
 	type sidecarContainer struct {
@@ -207,24 +231,31 @@ func (operatorCUE *OperatorCUE) UnifyAndExtractSidecar(clusterLabel string) (con
 	var extracted struct {
 		SidecarContainer sidecarContainer `json:"sidecar_container"`
 	}
-	// TODO handle extraction error by exploding loudly
-	err = Extract(unifiedValue, &extracted)
+	if err = Extract(unifiedValue, &extracted); err != nil {
+		return container, volumes, newError(fmt.Sprintf("extract sidecar container for %s", clusterLabel), err)
+	}
+	if err := checkSidecarPorts(extracted.SidecarContainer.Container); err != nil {
+		return container, volumes, newError(fmt.Sprintf("check sidecar container for %s", clusterLabel), err)
+	}
 
-	return extracted.SidecarContainer.Container, extracted.SidecarContainer.Volumes, err
+	return extracted.SidecarContainer.Container, extracted.SidecarContainer.Volumes, nil
 }
 
 // UnifyAndExtractSidecarConfig unifies a name and port with the Grey Matter sidecar configuration CUE for injected
 // sidecars, and returns those configuration objects, along with their kinds (e.g., listener, cluster, etc.)
+// If upstreams are given, they are unified as sidecar_config.Upstreams so that the CUE can generate objects
+// for each named port and protocol; otherwise only the (HTTP) port is.
 // It also extracts the special redis_listener object.
 // NB: This method expects that the embedded Mesh in the CUE has already been updated with a status.sidecar_list
 // for that redis_listener
-func (operatorCUE *OperatorCUE) UnifyAndExtractSidecarConfig(name string, port int) (configObjects []json.RawMessage, kinds []string, err error) {
+func (operatorCUE *OperatorCUE) UnifyAndExtractSidecarConfig(name string, port int, upstreams ...Upstream) (configObjects []json.RawMessage, kinds []string, err error) {
 
-	// Unify with Name and Port
+	// Unify with Name and Port, and Upstreams if given
 	injectNameAndPort := struct {
-		Name string `json:"Name"`
-		Port int    `json:"Port"`
-	}{Name: name, Port: port}
+		Name      string     `json:"Name"`
+		Port      int        `json:"Port"`
+		Upstreams []Upstream `json:"Upstreams,omitempty"`
+	}{Name: name, Port: port, Upstreams: upstreams}
 	withNameAndPort, _ := FromStruct("sidecar_config", injectNameAndPort)
 	unifiedValue := operatorCUE.GM.Unify(withNameAndPort) // bit overkill, but it shouldn't matter
 
@@ -240,7 +271,7 @@ func (operatorCUE *OperatorCUE) UnifyAndExtractSidecarConfig(name string, port i
 	err = Extract(unifiedValue, &extracted)
 	// Extract sidecar container and (spire) volume
 	if err != nil {
-		return nil, nil, fmt.Errorf("extraction from CUE failed after workload value unification: %w", err)
+		return nil, nil, newError(fmt.Sprintf("extract sidecar config for %s", name), err)
 	}
 
 	kinds = IdentifyGMConfigObjects(extracted.SidecarConfig.ConfigObjects)
@@ -257,7 +288,7 @@ func (operatorCUE *OperatorCUE) ExtractRedisListener() (configObject json.RawMes
 	err = Extract(operatorCUE.GM, &extracted)
 	// Extract sidecar container and (spire) volume
 	if err != nil {
-		return nil, fmt.Errorf("redis listener extraction from CUE failed after workload value unification: %w", err)
+		return nil, newError("extract redis listener", err)
 	}
 	return extracted.RedisListener, nil
 }
@@ -297,75 +328,29 @@ func IdentifyGMConfigObjects(rawObjects []json.RawMessage) (kinds []string) {
 	return kinds
 }
 
-// ExtractAndTypeK8sManifestObjects takes a list of raw k8s manifest objects, determines their types, and unmarshals
-// each one into an object of the correct type.
-func ExtractAndTypeK8sManifestObjects(manifests []json.RawMessage) (manifestObjects []client.Object) {
-
-	var ke struct {
-		Kind string `json:"kind"`
-	}
-
-	// TODO It'll be important to explode on an unmarshal error in case
-	// customers have provided custom CUE for the operator to install
-	for _, manifest := range manifests {
-		_ = json.Unmarshal(manifest, &ke)
-		//t.Log(ke.Kind)
-		switch ke.Kind {
-		case "Namespace":
-			var obj corev1.Namespace
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "Secret":
-			var obj corev1.Secret
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "Service":
-			var obj corev1.Service
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "Deployment":
-			var obj appsv1.Deployment
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "StatefulSet":
-			var obj appsv1.StatefulSet
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "DaemonSet":
-			var obj appsv1.DaemonSet
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "Role":
-			var obj rbacv1.Role
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "RoleBinding":
-			var obj rbacv1.RoleBinding
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "ServiceAccount":
-			var obj corev1.ServiceAccount
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "ClusterRole":
-			var obj rbacv1.ClusterRole
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "ClusterRoleBinding":
-			var obj rbacv1.ClusterRoleBinding
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "ConfigMap":
-			var obj corev1.ConfigMap
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		case "SecurityContextConstraints":
-			var obj opnshftsec.SecurityContextConstraints
-			_ = json.Unmarshal(manifest, &obj)
-			manifestObjects = append(manifestObjects, &obj)
-		default:
-			logger.Error(errors.New("got unrecognized K8s manifest object from CUE"), "ignoring", "Kind", ke.Kind, "Object", manifest)
+// ExtractAndTypeK8sManifestObjects takes a list of raw k8s manifest objects and unmarshals each one into an object
+// of the correct type if the scheme knows its kind, or an *unstructured.Unstructured otherwise.
+// Every manifest must have an apiVersion and kind.
+func ExtractAndTypeK8sManifestObjects(manifests []json.RawMessage) (manifestObjects []client.Object, err error) {
+	for idx, manifest := range manifests {
+		u := &unstructured.Unstructured{}
+		if err := u.UnmarshalJSON(manifest); err != nil {
+			return nil, fmt.Errorf("invalid k8s manifest at index %d: %w", idx, err)
+		}
+		gvk := u.GroupVersionKind()
+
+		obj, err := scheme.New(gvk)
+		if runtime.IsNotRegisteredError(err) {
+			manifestObjects = append(manifestObjects, u)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("k8s manifest %s %s at index %d: %w", gvk.Kind, u.GetName(), idx, err)
 		}
+		if err := json.Unmarshal(manifest, obj); err != nil {
+			return nil, fmt.Errorf("invalid k8s manifest %s %s at index %d: %w", gvk.Kind, u.GetName(), idx, err)
+		}
+		manifestObjects = append(manifestObjects, obj.(client.Object))
 	}
-	return manifestObjects
+	return manifestObjects, nil
 }
@@ -1,8 +1,12 @@
 package cuemodule
 
 import (
+	"encoding/json"
 	"testing"
 
+	appsv1 "k8s.io/api/apps/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -11,7 +15,10 @@ func TestLoadRedisListener(t *testing.T) {
 	ctrl.SetLogger(zap.New(zap.UseDevMode(true)))
 
 	operatorCUE, _, _ := LoadAll("core")
-	_, defaults := operatorCUE.ExtractConfig()
+	_, defaults, err := operatorCUE.ExtractConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
 	defaults.SidecarList = nil
 	if defaults.SidecarList == nil {
 		defaults.SidecarList = []string{}
@@ -21,3 +28,32 @@ func TestLoadRedisListener(t *testing.T) {
 	logger.Info("blurp", "listener", redisListener)
 	//logger.Info("LoadAll sidecarList", "SidecarList", defaults.SidecarList)
 }
+
+func TestExtractAndTypeK8sManifestObjects(t *testing.T) {
+	objs, err := ExtractAndTypeK8sManifestObjects([]json.RawMessage{
+		json.RawMessage(`{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "control"}}`),
+		json.RawMessage(`{"apiVersion": "networking.k8s.io/v1", "kind": "Ingress", "metadata": {"name": "edge"}}`),
+		json.RawMessage(`{"apiVersion": "monitoring.coreos.com/v1", "kind": "ServiceMonitor", "metadata": {"name": "control"}}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objs[0].(*appsv1.Deployment); !ok {
+		t.Errorf("expected a *Deployment, got %T", objs[0])
+	}
+	if _, ok := objs[1].(*networkingv1.Ingress); !ok {
+		t.Errorf("expected an *Ingress, got %T", objs[1])
+	}
+	if u, ok := objs[2].(*unstructured.Unstructured); !ok || u.GetKind() != "ServiceMonitor" || u.GetName() != "control" {
+		t.Errorf("expected an unstructured ServiceMonitor, got %#v", objs[2])
+	}
+
+	for _, manifest := range []string{
+		`{"metadata": {"name": "no-kind"}}`,
+		`{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"replicas": "one"}}`,
+	} {
+		if _, err := ExtractAndTypeK8sManifestObjects([]json.RawMessage{json.RawMessage(manifest)}); err == nil {
+			t.Errorf("expected an error for %s", manifest)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package cuemodule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"cuelang.org/go/cue"
+)
+
+// Overlay targets, naming the outputs an Overlay is unified with.
+const (
+	OverlayTargetK8s = "k8s"
+	OverlayTargetGM  = "gm"
+)
+
+// Overlay is a CUE fragment unified on top of the loaded k8s/outputs or gm/outputs values,
+// e.g. to tweak the base module for a cluster without forking it.
+type Overlay struct {
+	// Identifies where the fragment came from, e.g. a file path or ConfigMap key. Used in error positions.
+	Name string
+	// OverlayTargetK8s or OverlayTargetGM.
+	Target string
+	CUE    string
+}
+
+// OverlayError reports an Overlay that failed to compile or conflicts with the values it was unified with.
+// Err is an *Error listing the CUE errors.
+type OverlayError struct {
+	Overlay Overlay
+	Err     error
+}
+
+func (e *OverlayError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OverlayError) Unwrap() error {
+	return e.Err
+}
+
+// applyOverlays unifies each overlay, in order, with the value it targets.
+func (operatorCUE *OperatorCUE) applyOverlays(overlays []Overlay) error {
+	for _, o := range overlays {
+		var target *cue.Value
+		switch o.Target {
+		case OverlayTargetK8s:
+			target = &operatorCUE.K8s
+		case OverlayTargetGM:
+			target = &operatorCUE.GM
+		default:
+			return &OverlayError{Overlay: o, Err: fmt.Errorf("overlay %s has unknown target %q", o.Name, o.Target)}
+		}
+
+		v := target.Context().CompileString(o.CUE, cue.Filename(o.Name))
+		if err := v.Err(); err != nil {
+			return &OverlayError{Overlay: o, Err: newError(fmt.Sprintf("compile overlay %s", o.Name), err)}
+		}
+		unified := target.Unify(v)
+		if err := unified.Validate(); err != nil {
+			return &OverlayError{Overlay: o, Err: newError(fmt.Sprintf("unify overlay %s with %s/outputs", o.Name, o.Target), err)}
+		}
+		*target = unified
+	}
+	return nil
+}
+
+// LoadOverlayDir reads overlays from the .cue files in the k8s and gm subdirectories of dir, in lexical order.
+func LoadOverlayDir(dir string) ([]Overlay, error) {
+	var overlays []Overlay
+	for _, target := range []string{OverlayTargetK8s, OverlayTargetGM} {
+		paths, err := filepath.Glob(filepath.Join(dir, target, "*.cue"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read overlay: %w", err)
+			}
+			overlays = append(overlays, Overlay{Name: path, Target: target, CUE: string(b)})
+		}
+	}
+	return overlays, nil
+}
+
+// Overlays holds the overlays unified with the operator CUE whenever it is loaded, grouped by where they came from.
+// It is safe for concurrent use, and a nil *Overlays holds no overlays.
+type Overlays struct {
+	mu      sync.RWMutex
+	sources map[string][]Overlay
+}
+
+// Set replaces the overlays from a source.
+func (o *Overlays) Set(source string, overlays []Overlay) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.sources == nil {
+		o.sources = make(map[string][]Overlay)
+	}
+	o.sources[source] = overlays
+}
+
+// List returns the overlays from every source, ordered by source and then as they were set.
+func (o *Overlays) List() []Overlay {
+	if o == nil {
+		return nil
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	sources := make([]string, 0, len(o.sources))
+	for source := range o.sources {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	var overlays []Overlay
+	for _, source := range sources {
+		overlays = append(overlays, o.sources[source]...)
+	}
+	return overlays
+}
+
+// With returns the overlays from every source as if those from source were replaced.
+func (o *Overlays) With(source string, overlays []Overlay) []Overlay {
+	next := &Overlays{sources: map[string][]Overlay{source: overlays}}
+	if o != nil {
+		o.mu.RLock()
+		for s, ov := range o.sources {
+			if s != source {
+				next.sources[s] = ov
+			}
+		}
+		o.mu.RUnlock()
+	}
+	return next.List()
+}
@@ -0,0 +1,95 @@
+package cuemodule
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue"
+	"cuelang.org/go/cue/cuecontext"
+)
+
+func TestApplyOverlays(t *testing.T) {
+	load := func() *OperatorCUE {
+		ctx := cuecontext.New()
+		return &OperatorCUE{
+			K8s: ctx.CompileString(`mesh: spec: { release_version: *"1.7" | string, install_namespace: "greymatter" }`),
+			GM:  ctx.CompileString(`defaults: redis_port: 6379`),
+		}
+	}
+
+	operatorCUE := load()
+	if err := operatorCUE.applyOverlays([]Overlay{
+		{Name: "release.cue", Target: OverlayTargetK8s, CUE: `mesh: spec: release_version: "1.8"`},
+		{Name: "extra.cue", Target: OverlayTargetGM, CUE: `defaults: extra: true`},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := operatorCUE.K8s.LookupPath(cue.ParsePath("mesh.spec.release_version")).String(); v != "1.8" {
+		t.Errorf("expected overlay to set release_version 1.8, got %s", v)
+	}
+	if v, _ := operatorCUE.GM.LookupPath(cue.ParsePath("defaults.extra")).Bool(); !v {
+		t.Error("expected overlay to add defaults.extra")
+	}
+
+	err := load().applyOverlays([]Overlay{
+		{Name: "conflict.cue", Target: OverlayTargetK8s, CUE: `mesh: spec: install_namespace: "other"`},
+	})
+	var overlayErr *OverlayError
+	if !errors.As(err, &overlayErr) || overlayErr.Overlay.Name != "conflict.cue" {
+		t.Fatalf("expected an OverlayError for conflict.cue, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "install_namespace") {
+		t.Errorf("expected the conflicting path to be reported, got %s", err)
+	}
+}
+
+func TestLoadOverlayDir(t *testing.T) {
+	dir := t.TempDir()
+	for path, contents := range map[string]string{
+		"k8s/b.cue": "b: 2",
+		"k8s/a.cue": "a: 1",
+		"gm/c.cue":  "c: 3",
+		"gm/README": "ignored",
+		"other.cue": "ignored: true",
+	} {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, path)), 0o755)
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	overlays, err := LoadOverlayDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, o := range overlays {
+		got = append(got, o.Target+":"+filepath.Base(o.Name))
+	}
+	if expected := "k8s:a.cue k8s:b.cue gm:c.cue"; strings.Join(got, " ") != expected {
+		t.Errorf("expected overlays %s, got %s", expected, strings.Join(got, " "))
+	}
+}
+
+func TestOverlays(t *testing.T) {
+	var nilOverlays *Overlays
+	if len(nilOverlays.List()) != 0 {
+		t.Error("expected a nil *Overlays to hold no overlays")
+	}
+
+	o := &Overlays{}
+	o.Set("dir", []Overlay{{Name: "a"}})
+	o.Set("configmaps", []Overlay{{Name: "b"}})
+	if list := o.List(); len(list) != 2 || list[0].Name != "b" || list[1].Name != "a" {
+		t.Errorf("expected overlays ordered by source, got %v", list)
+	}
+	if list := o.With("configmaps", []Overlay{{Name: "c"}}); len(list) != 2 || list[0].Name != "c" {
+		t.Errorf("expected overlays with configmaps replaced, got %v", list)
+	}
+	if list := o.List(); list[0].Name != "b" {
+		t.Error("expected With not to modify the overlays")
+	}
+}
@@ -0,0 +1,165 @@
+package cuemodule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// sidecarLogLevels are the log levels accepted by the greymatter.io/sidecar-log-level annotation.
+var sidecarLogLevels = map[string]bool{
+	"trace":    true,
+	"debug":    true,
+	"info":     true,
+	"warn":     true,
+	"warning":  true,
+	"error":    true,
+	"critical": true,
+	"off":      true,
+}
+
+// SidecarOverrides holds per-workload changes to an injected sidecar container,
+// parsed from the greymatter.io/sidecar-* annotations of the workload's pod template.
+// They are unified with sidecar_container in the CUE, which sets them on the container it defines.
+type SidecarOverrides struct {
+	CPU        *resource.Quantity     `json:"cpu,omitempty"`
+	Memory     *resource.Quantity     `json:"memory,omitempty"`
+	Image      string                 `json:"image,omitempty"`
+	LogLevel   string                 `json:"log_level,omitempty"`
+	ExtraPorts []corev1.ContainerPort `json:"extra_ports,omitempty"`
+}
+
+// ParseSidecarOverrides parses the sidecar override annotations of a workload.
+// It returns an error naming the annotation and describing the problem for each bad value.
+func ParseSidecarOverrides(annotations map[string]string) (SidecarOverrides, error) {
+	var overrides SidecarOverrides
+	var problems []string
+
+	for _, a := range []struct {
+		key string
+		dst **resource.Quantity
+	}{
+		{wellknown.ANNOTATION_SIDECAR_CPU, &overrides.CPU},
+		{wellknown.ANNOTATION_SIDECAR_MEMORY, &overrides.Memory},
+	} {
+		v, ok := annotations[a.key]
+		if !ok {
+			continue
+		}
+		q, err := resource.ParseQuantity(strings.TrimSpace(v))
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a valid quantity", a.key, v))
+			continue
+		}
+		if q.Sign() <= 0 {
+			problems = append(problems, fmt.Sprintf("%s: %q must be greater than zero", a.key, v))
+			continue
+		}
+		*a.dst = &q
+	}
+
+	if v, ok := annotations[wellknown.ANNOTATION_SIDECAR_IMAGE]; ok {
+		if v == "" || strings.ContainsAny(v, " \t\n") {
+			problems = append(problems, fmt.Sprintf("%s: %q is not a valid image reference", wellknown.ANNOTATION_SIDECAR_IMAGE, v))
+		} else {
+			overrides.Image = v
+		}
+	}
+
+	if v, ok := annotations[wellknown.ANNOTATION_SIDECAR_LOG_LEVEL]; ok {
+		level := strings.ToLower(strings.TrimSpace(v))
+		if !sidecarLogLevels[level] {
+			problems = append(problems, fmt.Sprintf("%s: %q is not one of trace, debug, info, warn, warning, error, critical, or off", wellknown.ANNOTATION_SIDECAR_LOG_LEVEL, v))
+		} else {
+			overrides.LogLevel = level
+		}
+	}
+
+	if v, ok := annotations[wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS]; ok {
+		ports, err := parseExtraPorts(v)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS, err))
+		} else {
+			overrides.ExtraPorts = ports
+		}
+	}
+
+	if len(problems) > 0 {
+		return SidecarOverrides{}, fmt.Errorf("invalid sidecar annotations: %s", strings.Join(problems, "; "))
+	}
+	return overrides, nil
+}
+
+// parseExtraPorts parses a comma-separated list of ports of the form [name:]port[/protocol].
+func parseExtraPorts(v string) ([]corev1.ContainerPort, error) {
+	var ports []corev1.ContainerPort
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		port := corev1.ContainerPort{Protocol: corev1.ProtocolTCP}
+		spec := entry
+		if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+			switch proto := corev1.Protocol(strings.ToUpper(spec[idx+1:])); proto {
+			case corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+				port.Protocol = proto
+			default:
+				return nil, fmt.Errorf("%q has unknown protocol %q; expected TCP, UDP, or SCTP", entry, spec[idx+1:])
+			}
+			spec = spec[:idx]
+		}
+		if idx := strings.Index(spec, ":"); idx >= 0 {
+			port.Name = spec[:idx]
+			if errs := validation.IsValidPortName(port.Name); len(errs) > 0 {
+				return nil, fmt.Errorf("%q has invalid port name: %s", entry, strings.Join(errs, ", "))
+			}
+			spec = spec[idx+1:]
+		}
+		n, err := strconv.Atoi(spec)
+		if err != nil || validation.IsValidPortNum(n) != nil {
+			return nil, fmt.Errorf("%q does not have a port number between 1 and 65535", entry)
+		}
+		port.ContainerPort = int32(n)
+		ports = append(ports, port)
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("%q lists no ports", v)
+	}
+	return ports, nil
+}
+
+// IsZero reports whether no overrides are set.
+func (o SidecarOverrides) IsZero() bool {
+	return o.CPU == nil && o.Memory == nil && o.Image == "" && o.LogLevel == "" && len(o.ExtraPorts) == 0
+}
+
+// checkSidecarPorts returns an error if two of a sidecar container's ports share a number and protocol or a name,
+// e.g. because an extra port set by the greymatter.io/sidecar-extra-ports annotation conflicts with one from the CUE.
+func checkSidecarPorts(container corev1.Container) error {
+	for idx, p := range container.Ports {
+		for _, other := range container.Ports[:idx] {
+			if p.ContainerPort == other.ContainerPort && protocolOf(p) == protocolOf(other) {
+				return fmt.Errorf("port %d/%s is used more than once by the sidecar", p.ContainerPort, protocolOf(p))
+			}
+			if p.Name != "" && p.Name == other.Name {
+				return fmt.Errorf("port name %q is used more than once by the sidecar", p.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// protocolOf returns a container port's protocol, which defaults to TCP.
+func protocolOf(p corev1.ContainerPort) corev1.Protocol {
+	if p.Protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return p.Protocol
+}
@@ -0,0 +1,147 @@
+package cuemodule
+
+import (
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseSidecarOverrides(t *testing.T) {
+	overrides, err := ParseSidecarOverrides(map[string]string{
+		wellknown.ANNOTATION_SIDECAR_CPU:         "500m",
+		wellknown.ANNOTATION_SIDECAR_MEMORY:      "256Mi",
+		wellknown.ANNOTATION_SIDECAR_IMAGE:       "quay.io/greymatterio/gm-proxy:1.7.1",
+		wellknown.ANNOTATION_SIDECAR_LOG_LEVEL:   "DEBUG",
+		wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "metrics:8081, 9000/udp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if overrides.LogLevel != "debug" || overrides.Image != "quay.io/greymatterio/gm-proxy:1.7.1" {
+		t.Errorf("unexpected overrides %+v", overrides)
+	}
+	if len(overrides.ExtraPorts) != 2 {
+		t.Fatalf("expected 2 extra ports, got %v", overrides.ExtraPorts)
+	}
+	if p := overrides.ExtraPorts[0]; p.Name != "metrics" || p.ContainerPort != 8081 || p.Protocol != corev1.ProtocolTCP {
+		t.Errorf("unexpected metrics port %v", p)
+	}
+	if p := overrides.ExtraPorts[1]; p.Name != "" || p.ContainerPort != 9000 || p.Protocol != corev1.ProtocolUDP {
+		t.Errorf("unexpected UDP port %v", p)
+	}
+
+	for name, tc := range map[string]struct {
+		annotations map[string]string
+		expected    string
+	}{
+		"bad cpu": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_CPU: "lots"},
+			`greymatter.io/sidecar-cpu: "lots" is not a valid quantity`,
+		},
+		"zero memory": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_MEMORY: "0"},
+			`greymatter.io/sidecar-memory: "0" must be greater than zero`,
+		},
+		"bad image": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_IMAGE: "gm proxy"},
+			`greymatter.io/sidecar-image: "gm proxy" is not a valid image reference`,
+		},
+		"bad log level": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_LOG_LEVEL: "verbose"},
+			`greymatter.io/sidecar-log-level: "verbose" is not one of`,
+		},
+		"port out of range": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "metrics:70000"},
+			`"metrics:70000" does not have a port number between 1 and 65535`,
+		},
+		"bad protocol": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "8081/http"},
+			`"8081/http" has unknown protocol "http"`,
+		},
+		"bad port name": {
+			map[string]string{wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "Metrics_Port:8081"},
+			`"Metrics_Port:8081" has invalid port name`,
+		},
+	} {
+		_, err := ParseSidecarOverrides(tc.annotations)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tc.expected, err)
+		}
+	}
+
+}
+
+// sidecarCUE stands in for the core CUE's sidecar_container, setting the overrides unified with it on its container.
+const sidecarCUE = `sidecar_container: {
+	name:        string
+	image:       *"quay.io/greymatterio/gm-proxy:1.7.0" | string
+	log_level:   *"info" | string
+	cpu:         *"200m" | string
+	memory:      *"512Mi" | string
+	extra_ports: *[] | [...{...}]
+	container: {
+		name:  "sidecar"
+		image: sidecar_container.image
+		env: [{name: "ENVOY_LOG_LEVEL", value: log_level}]
+		ports: [{name: "proxy", containerPort: 10808}] + extra_ports
+		resources: limits: {cpu: sidecar_container.cpu, memory: sidecar_container.memory}
+		resources: requests: resources.limits
+	}
+	volumes: []
+}`
+
+func TestUnifyAndExtractSidecar(t *testing.T) {
+	operatorCUE := &OperatorCUE{K8s: cuecontext.New().CompileString(sidecarCUE)}
+
+	container, _, err := operatorCUE.UnifyAndExtractSidecar("example", SidecarOverrides{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if container.Image != "quay.io/greymatterio/gm-proxy:1.7.0" || len(container.Ports) != 1 {
+		t.Errorf("expected the CUE's defaults without overrides, got %+v", container)
+	}
+
+	overrides, err := ParseSidecarOverrides(map[string]string{
+		wellknown.ANNOTATION_SIDECAR_CPU:         "500m",
+		wellknown.ANNOTATION_SIDECAR_MEMORY:      "256Mi",
+		wellknown.ANNOTATION_SIDECAR_IMAGE:       "quay.io/greymatterio/gm-proxy:1.7.1",
+		wellknown.ANNOTATION_SIDECAR_LOG_LEVEL:   "debug",
+		wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "metrics:8081",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	container, _, err = operatorCUE.UnifyAndExtractSidecar("example", overrides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cpu := container.Resources.Limits[corev1.ResourceCPU]; cpu.Cmp(resource.MustParse("500m")) != 0 {
+		t.Errorf("expected a CPU limit of 500m, got %s", cpu.String())
+	}
+	if mem := container.Resources.Requests[corev1.ResourceMemory]; mem.Cmp(resource.MustParse("256Mi")) != 0 {
+		t.Errorf("expected a memory request of 256Mi, got %s", mem.String())
+	}
+	if container.Image != "quay.io/greymatterio/gm-proxy:1.7.1" {
+		t.Errorf("expected image to be overridden, got %s", container.Image)
+	}
+	if len(container.Env) != 1 || container.Env[0].Value != "debug" {
+		t.Errorf("expected log level env to be debug, got %v", container.Env)
+	}
+	if len(container.Ports) != 2 || container.Ports[1].Name != "metrics" || container.Ports[1].ContainerPort != 8081 {
+		t.Errorf("expected the metrics port to be added, got %v", container.Ports)
+	}
+
+	conflicting, err := ParseSidecarOverrides(map[string]string{wellknown.ANNOTATION_SIDECAR_EXTRA_PORTS: "10808"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := operatorCUE.UnifyAndExtractSidecar("example", conflicting); err == nil || !strings.Contains(err.Error(), "port 10808/TCP is used more than once") {
+		t.Errorf("expected an error for an extra port already used by the sidecar, got %v", err)
+	}
+}
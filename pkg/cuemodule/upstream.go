@@ -0,0 +1,109 @@
+package cuemodule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Protocols of an upstream port behind an injected sidecar.
+const (
+	UpstreamHTTP  = "http"
+	UpstreamHTTP2 = "http2" // also accepted as "grpc"
+	UpstreamTCP   = "tcp"
+)
+
+// Upstream is a named port of a workload that its injected sidecar proxies to.
+type Upstream struct {
+	Name     string `json:"name"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+// ParseUpstreams parses the upstream port of a workload from its greymatter.io/inject-sidecar-to annotation,
+// along with any upstreams listed in its greymatter.io/upstream-ports annotation.
+// If upstreams are listed, the greymatter.io/inject-sidecar-to port must be one of them.
+// It returns false if the workload does not have a sidecar injected.
+func ParseUpstreams(annotations map[string]string) (port int, upstreams []Upstream, ok bool, err error) {
+	injectTo, ok := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
+	if !ok {
+		return 0, nil, false, nil
+	}
+	port, err = strconv.Atoi(injectTo)
+	if err != nil || validation.IsValidPortNum(port) != nil {
+		return 0, nil, true, fmt.Errorf("%s: %q is not a port number between 1 and 65535", wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT, injectTo)
+	}
+
+	listed, ok := annotations[wellknown.ANNOTATION_UPSTREAM_PORTS]
+	if !ok {
+		return port, nil, true, nil
+	}
+	upstreams, err = parseUpstreamPorts(listed)
+	if err != nil {
+		return 0, nil, true, fmt.Errorf("%s: %v", wellknown.ANNOTATION_UPSTREAM_PORTS, err)
+	}
+	for _, upstream := range upstreams {
+		if upstream.Port == port {
+			return port, upstreams, true, nil
+		}
+	}
+	return 0, nil, true, fmt.Errorf("%s: port %d from %s is not listed", wellknown.ANNOTATION_UPSTREAM_PORTS, port, wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT)
+}
+
+// parseUpstreamPorts parses a comma-separated list of upstreams of the form [name:]port[/protocol].
+// The protocol defaults to http, and the name to the protocol and port, e.g. "tcp-5432".
+func parseUpstreamPorts(v string) ([]Upstream, error) {
+	var upstreams []Upstream
+	names := make(map[string]bool)
+	ports := make(map[int]bool)
+	for _, entry := range strings.Split(v, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		upstream := Upstream{Protocol: UpstreamHTTP}
+		spec := entry
+		if idx := strings.LastIndex(spec, "/"); idx >= 0 {
+			switch proto := strings.ToLower(spec[idx+1:]); proto {
+			case UpstreamHTTP, UpstreamHTTP2, UpstreamTCP:
+				upstream.Protocol = proto
+			case "grpc":
+				upstream.Protocol = UpstreamHTTP2
+			default:
+				return nil, fmt.Errorf("%q has unknown protocol %q; expected http, http2, grpc, or tcp", entry, spec[idx+1:])
+			}
+			spec = spec[:idx]
+		}
+		if idx := strings.Index(spec, ":"); idx >= 0 {
+			upstream.Name = spec[:idx]
+			if errs := validation.IsDNS1035Label(upstream.Name); len(errs) > 0 {
+				return nil, fmt.Errorf("%q has invalid name: %s", entry, strings.Join(errs, ", "))
+			}
+			spec = spec[idx+1:]
+		}
+		n, err := strconv.Atoi(spec)
+		if err != nil || validation.IsValidPortNum(n) != nil {
+			return nil, fmt.Errorf("%q does not have a port number between 1 and 65535", entry)
+		}
+		upstream.Port = n
+		if upstream.Name == "" {
+			upstream.Name = fmt.Sprintf("%s-%d", upstream.Protocol, n)
+		}
+		if ports[n] {
+			return nil, fmt.Errorf("port %d is listed more than once", n)
+		}
+		if names[upstream.Name] {
+			return nil, fmt.Errorf("name %q is listed more than once", upstream.Name)
+		}
+		ports[n], names[upstream.Name] = true, true
+		upstreams = append(upstreams, upstream)
+	}
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("%q lists no ports", v)
+	}
+	return upstreams, nil
+}
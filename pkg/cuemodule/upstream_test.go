@@ -0,0 +1,141 @@
+package cuemodule
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"cuelang.org/go/cue/cuecontext"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+)
+
+func TestParseUpstreams(t *testing.T) {
+	port, upstreams, ok, err := ParseUpstreams(map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "3000"})
+	if err != nil || !ok {
+		t.Fatalf("expected a sidecar to be injected, got %v, %v", ok, err)
+	}
+	if port != 3000 || upstreams != nil {
+		t.Errorf("expected only port 3000, got %d and %v", port, upstreams)
+	}
+
+	if _, _, ok, _ := ParseUpstreams(map[string]string{wellknown.ANNOTATION_UPSTREAM_PORTS: "8080"}); ok {
+		t.Error("expected no sidecar to be injected without the inject-sidecar-to annotation")
+	}
+
+	port, upstreams, _, err = ParseUpstreams(map[string]string{
+		wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "9090",
+		wellknown.ANNOTATION_UPSTREAM_PORTS:         "api:8080, rpc:9090/gRPC, 5432/tcp",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Upstream{
+		{Name: "api", Port: 8080, Protocol: UpstreamHTTP},
+		{Name: "rpc", Port: 9090, Protocol: UpstreamHTTP2},
+		{Name: "tcp-5432", Port: 5432, Protocol: UpstreamTCP},
+	}
+	if port != 9090 || len(upstreams) != len(expected) {
+		t.Fatalf("expected port 9090 and %v, got %d and %v", expected, port, upstreams)
+	}
+	for idx := range expected {
+		if upstreams[idx] != expected[idx] {
+			t.Errorf("expected %v, got %v", expected[idx], upstreams[idx])
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		annotations map[string]string
+		expected    string
+	}{
+		"non-numeric inject-sidecar-to": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "true"},
+			`greymatter.io/inject-sidecar-to: "true" is not a port number`,
+		},
+		"unknown protocol": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "8080", wellknown.ANNOTATION_UPSTREAM_PORTS: "8080/udp"},
+			`greymatter.io/upstream-ports: "8080/udp" has unknown protocol "udp"`,
+		},
+		"duplicate port": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "8080", wellknown.ANNOTATION_UPSTREAM_PORTS: "a:8080,b:8080/tcp"},
+			"port 8080 is listed more than once",
+		},
+		"bad name": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "8080", wellknown.ANNOTATION_UPSTREAM_PORTS: "My_API:8080"},
+			`"My_API:8080" has invalid name`,
+		},
+		"inject-sidecar-to not listed": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "3000", wellknown.ANNOTATION_UPSTREAM_PORTS: "api:8080"},
+			"port 3000 from greymatter.io/inject-sidecar-to is not listed",
+		},
+		"empty list": {
+			map[string]string{wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT: "8080", wellknown.ANNOTATION_UPSTREAM_PORTS: " , "},
+			"lists no ports",
+		},
+	} {
+		_, _, _, err := ParseUpstreams(tc.annotations)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tc.expected, err)
+		}
+	}
+}
+
+// upstreamsCUE stands in for the core CUE's sidecar_config, generating a cluster for each upstream.
+const upstreamsCUE = `sidecar_config: {
+	Name:              string
+	Port:              int
+	Upstreams:         *[{name: "http-\(Port)", port: Port, protocol: "http"}] | [...{name: string, port: int, protocol: "http" | "http2" | "tcp"}]
+	LocalName:         "\(Name)-local"
+	EgressToRedisName: "\(Name)-egress-to-redis"
+	objects: [ for u in Upstreams {cluster_key: "\(LocalName)-\(u.name)", protocol: u.protocol, port: u.port}]
+}`
+
+func TestUnifyAndExtractSidecarConfig(t *testing.T) {
+	operatorCUE := &OperatorCUE{GM: cuecontext.New().CompileString(upstreamsCUE)}
+
+	for name, tc := range map[string]struct {
+		upstreams []Upstream
+		expected  []string
+	}{
+		"port only": {nil, []string{"example-local-http-8080"}},
+		"upstreams": {
+			[]Upstream{{Name: "api", Port: 8080, Protocol: UpstreamHTTP}, {Name: "rpc", Port: 9090, Protocol: UpstreamHTTP2}},
+			[]string{"example-local-api", "example-local-rpc"},
+		},
+	} {
+		objects, kinds, err := operatorCUE.UnifyAndExtractSidecarConfig("example", 8080, tc.upstreams...)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var keys []string
+		for idx, obj := range objects {
+			if kinds[idx] != "cluster" {
+				t.Errorf("%s: expected a cluster, got %s", name, kinds[idx])
+			}
+			keys = append(keys, clusterKeyOf(obj))
+		}
+		if !reflect.DeepEqual(keys, tc.expected) {
+			t.Errorf("%s: expected clusters %v, got %v", name, tc.expected, keys)
+		}
+	}
+
+	// A closed sidecar_config that doesn't define Upstreams can't be unified with them.
+	closed := &OperatorCUE{GM: cuecontext.New().CompileString(`
+		#SidecarConfig: {Name: string, Port: int, objects: []}
+		sidecar_config: #SidecarConfig
+	`)}
+	if _, _, err := closed.UnifyAndExtractSidecarConfig("example", 8080); err != nil {
+		t.Errorf("expected a port alone to unify, got %v", err)
+	}
+	if _, _, err := closed.UnifyAndExtractSidecarConfig("example", 8080, Upstream{Name: "api", Port: 8080, Protocol: UpstreamHTTP}); err == nil {
+		t.Error("expected upstreams not to unify with a closed sidecar_config")
+	}
+}
+
+func clusterKeyOf(obj json.RawMessage) string {
+	var keys struct {
+		ClusterKey string `json:"cluster_key"`
+	}
+	json.Unmarshal(obj, &keys)
+	return keys.ClusterKey
+}
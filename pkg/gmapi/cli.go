@@ -1,4 +1,4 @@
-// Package gmapi executes greymatter CLI commands to configure mesh behavior
+// Package gmapi executes greymatter CLI commands (or equivalent HTTP requests) to configure mesh behavior
 // in Control and Catalog APIs in each install namespace for each mesh.
 // It enables Mesh CR specifications to define how a mesh should be configured.
 package gmapi
@@ -6,12 +6,14 @@ package gmapi
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"github.com/greymatter-io/operator/api/v1alpha1"
 	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
 	"github.com/greymatter-io/operator/pkg/wellknown"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
-	"strconv"
 	"sync"
 	"time"
 )
@@ -20,28 +22,54 @@ var (
 	logger = ctrl.Log.WithName("gmapi")
 )
 
+// ConditionReporter receives conditions describing progress toward reaching and configuring
+// the Control and Catalog APIs of the named mesh.
+type ConditionReporter func(mesh string, condition metav1.Condition)
+
 // CLI exposes methods for configuring clients that execute greymatter CLI commands.
+// It holds a Client for each mesh, keyed by the name of its Mesh.
 type CLI struct {
 	*sync.RWMutex
-	Client      *Client
-	operatorCUE *cuemodule.OperatorCUE
+	clients map[string]*Client
+
+	// If set, is passed to each Client for reporting its progress.
+	ReportCondition ConditionReporter
+
+	// If set, is passed to each Client for pruning mesh configs that are removed from the CUE.
+	Inventory InventoryStore
+
+	// If true, Clients make requests to Control and Catalog directly instead of using the greymatter CLI.
+	native bool
+}
+
+// WithNativeClient configures Clients to make HTTP requests to Control and Catalog
+// instead of executing greymatter CLI commands, so that the CLI does not need to be installed.
+func WithNativeClient() func(*CLI) {
+	return func(c *CLI) {
+		c.native = true
+	}
 }
 
 // New returns a new *CLI instance.
 // It receives a context for cleaning up goroutines started by the *CLI.
-func New(ctx context.Context, operatorCUE *cuemodule.OperatorCUE) (*CLI, error) {
-	v, err := cliversion()
-	if err != nil {
-		logger.Error(err, "Failed to initialize greymatter CLI")
-		return nil, err
+func New(ctx context.Context, opts ...func(*CLI)) (*CLI, error) {
+	gmcli := &CLI{
+		RWMutex: &sync.RWMutex{},
+		clients: make(map[string]*Client),
+	}
+	for _, opt := range opts {
+		opt(gmcli)
 	}
 
-	logger.Info("Using greymatter CLI", "Version", v)
-
-	gmcli := &CLI{
-		RWMutex:     &sync.RWMutex{},
-		Client:      nil,
-		operatorCUE: operatorCUE,
+	if gmcli.native {
+		logger.Info("Using native Control and Catalog API client")
+	} else {
+		v, err := cliversion()
+		if err != nil {
+			logger.Error(err, "Failed to initialize greymatter CLI")
+			return nil, err
+		}
+		logger.Info("Using greymatter CLI", "Version", v)
 	}
 
 	// Cancel all Client goroutines if package context is done.
@@ -50,31 +78,41 @@ func New(ctx context.Context, operatorCUE *cuemodule.OperatorCUE) (*CLI, error)
 		c.RLock()
 		defer c.RUnlock()
 		logger.Info("Cancelling Client goroutines")
-		if c.Client != nil {
-			c.Client.Cancel()
+		for _, cl := range c.clients {
+			cl.Cancel()
 		}
 	}(gmcli)
 
 	return gmcli, nil
 }
 
-// ConfigureMeshClient initializes or updates a Client with flags specifying connection options
-// for reaching Control and Catalog for the given Mesh CR.
-func (c *CLI) ConfigureMeshClient(mesh *v1alpha1.Mesh) {
-	conf := mkCLIConfig( // TODO this should come from config
-		// control
-		fmt.Sprintf("http://controlensemble.%s.svc.cluster.local:5555", mesh.Spec.InstallNamespace),
-		// catalog
-		fmt.Sprintf("http://catalog.%s.svc.cluster.local:8080", mesh.Spec.InstallNamespace),
-		mesh.Name,
-	)
+// ConfigureMeshClient initializes or updates the Client for the given Mesh CR with flags specifying
+// connection options for reaching its Control and Catalog, then applies the core mesh configs
+// extracted from operatorCUE, which must already be unified with the Mesh.
+func (c *CLI) ConfigureMeshClient(mesh *v1alpha1.Mesh, operatorCUE *cuemodule.OperatorCUE) {
+	controlURL, catalogURL := APIURLs(mesh)
+
+	conf := mkCLIConfig(controlURL, catalogURL, mesh.Name)
 	flags := []string{"--base64-config", conf}
 
-	if err := c.configureMeshClient(mesh, flags...); err != nil {
+	var api *gmhttp.Client
+	if c.native {
+		api = gmhttp.New(controlURL, catalogURL, nil)
+	}
+
+	if err := c.configureMeshClient(mesh, operatorCUE, api, flags...); err != nil {
 		logger.Error(err, "failed to configure Client", "Mesh", mesh.Name)
 	}
 }
 
+// APIURLs returns the in-cluster base URLs of a Mesh's Control and Catalog APIs.
+func APIURLs(mesh *v1alpha1.Mesh) (controlURL, catalogURL string) {
+	// TODO this should come from config
+	controlURL = fmt.Sprintf("http://controlensemble.%s.svc.cluster.local:5555", mesh.Spec.InstallNamespace)
+	catalogURL = fmt.Sprintf("http://catalog.%s.svc.cluster.local:8080", mesh.Spec.InstallNamespace)
+	return controlURL, catalogURL
+}
+
 func mkCLIConfig(apiHost, catalogHost, catalogMesh string) string {
 	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf(`
 	[api]
@@ -85,49 +123,55 @@ func mkCLIConfig(apiHost, catalogHost, catalogMesh string) string {
 	`, apiHost, catalogHost, catalogMesh)))
 }
 
-func (c *CLI) configureMeshClient(mesh *v1alpha1.Mesh, flags ...string) error {
+func (c *CLI) configureMeshClient(mesh *v1alpha1.Mesh, operatorCUE *cuemodule.OperatorCUE, api *gmhttp.Client, flags ...string) error {
 	c.Lock()
 	defer c.Unlock()
 
 	// Close an existing cmds channel if updating
-	if c.Client != nil {
+	if existing, ok := c.clients[mesh.Name]; ok {
 		logger.Info("Updating mesh Client", "Mesh", mesh.Name)
-		c.Client.Cancel()
+		existing.Cancel()
 	} else {
 		logger.Info("Initializing mesh Client", "Mesh", mesh.Name)
 	}
 
-	cl, err := newClient(c.operatorCUE, mesh, flags...)
+	cl, err := newClient(operatorCUE, mesh, c.ReportCondition, c.Inventory, api, flags...)
 	if err != nil {
 		return err
 	}
 
-	c.Client = cl
+	c.clients[mesh.Name] = cl
 
 	return nil
 }
 
-// RemoveMeshClient cleans up a Client's goroutines before removing it from the *CLI.
-func (c *CLI) RemoveMeshClient() {
-	if c.Client != nil {
-		c.Client.Cancel()
+// MeshClient returns the Client for the named mesh, or nil if it has not been configured.
+func (c *CLI) MeshClient(mesh string) *Client {
+	c.RLock()
+	defer c.RUnlock()
+	return c.clients[mesh]
+}
+
+// RemoveMeshClient cleans up the named mesh's Client's goroutines before removing it from the *CLI.
+func (c *CLI) RemoveMeshClient(mesh string) {
+	c.Lock()
+	defer c.Unlock()
+	if cl, ok := c.clients[mesh]; ok {
+		cl.Cancel()
+		delete(c.clients, mesh)
 	}
 }
 
 // ConfigureSidecar applies fabric objects that add a workload to the mesh specified
 // given the workload's annotations and a list of its corev1.Containers.
-func (c *CLI) ConfigureSidecar(operatorCUE *cuemodule.OperatorCUE, name string, annotations map[string]string) {
-	//annotations := metadata.Annotations
-	injectedSidecarPortString, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
-	var injectedSidecarPort int
-	if injectSidecar {
-		parsedPort, err := strconv.Atoi(injectedSidecarPortString)
-		if err != nil {
-			logger.Error(err, "provided port for sidecar upstream could not be parsed as int", wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT, injectedSidecarPortString)
-			return
-		}
-		injectedSidecarPort = parsedPort
-	} else { // if we're not injecting a sidecar, skip configuration
+// It waits for the mesh's Client until ctx is done, then drops the configuration.
+func (c *CLI) ConfigureSidecar(ctx context.Context, operatorCUE *cuemodule.OperatorCUE, mesh, name string, annotations map[string]string) {
+	port, upstreams, injectSidecar, err := cuemodule.ParseUpstreams(annotations)
+	if err != nil {
+		logger.Error(err, "provided upstream ports for sidecar could not be parsed", "name", name)
+		return
+	}
+	if !injectSidecar { // if we're not injecting a sidecar, skip configuration
 		return
 	}
 
@@ -137,52 +181,89 @@ func (c *CLI) ConfigureSidecar(operatorCUE *cuemodule.OperatorCUE, name string,
 		return
 	}
 
-	configObjects, kinds, err := operatorCUE.UnifyAndExtractSidecarConfig(name, injectedSidecarPort)
+	configObjects, kinds, err := operatorCUE.UnifyAndExtractSidecarConfig(name, port, upstreams...)
 	if err != nil {
-		logger.Error(err, "Failed to unify or extract CUE", "name", name, "injectedSidecarPort", injectedSidecarPort)
+		logger.Error(err, "Failed to unify or extract CUE", "name", name, "injectedSidecarPort", port, "upstreams", upstreams)
 	}
 
-	c.EnsureClient("ConfigureSidecar")
-	ApplyAll(c.Client, configObjects, kinds)
+	cl := c.EnsureClient(ctx, mesh, "ConfigureSidecar")
+	if cl == nil {
+		logger.Info("No greymatter client for mesh; dropping sidecar configuration", "Mesh", mesh, "name", name)
+		return
+	}
+	ApplyAll(cl, configObjects, kinds)
 }
 
-func (c *CLI) EnsureClient(in string) {
+// EnsureClient blocks until the named mesh has a Client, then returns it.
+// It returns nil if ctx is done first, e.g. because the mesh was removed or never finished rolling out.
+func (c *CLI) EnsureClient(ctx context.Context, mesh, in string) *Client {
 	for {
-		if c.Client != nil {
-			break
+		if cl := c.MeshClient(mesh); cl != nil {
+			return cl
+		}
+		logger.Info(fmt.Sprintf("(in %s) greymatter client does not yet exist, will retry in 10 seconds", in), "Mesh", mesh)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(10 * time.Second):
 		}
-		logger.Info(fmt.Sprintf("(in %s) greymatter client does not yet exist, will retry in 10 seconds", in))
-		time.Sleep(10 * time.Second)
 	}
 }
 
 // UnconfigureSidecar removes fabric objects, disconnecting the workload from the mesh specified
-func (c *CLI) UnconfigureSidecar(operatorCUE *cuemodule.OperatorCUE, name string, annotations map[string]string) {
+func (c *CLI) UnconfigureSidecar(operatorCUE *cuemodule.OperatorCUE, mesh, name string, annotations map[string]string) {
+	configObjects, kinds, ok := unconfigureSidecarObjects(operatorCUE, name, annotations)
+	if !ok {
+		return
+	}
+
+	cl := c.MeshClient(mesh)
+	if cl == nil {
+		logger.Info("No greymatter client for mesh; skipping sidecar unconfiguration", "Mesh", mesh, "name", name)
+		return
+	}
+	UnApplyAll(cl, configObjects, kinds)
+}
+
+// UnconfigureSidecarAndWait removes fabric objects for the workload like UnconfigureSidecar,
+// but waits for the results and returns a description of each object that could not be deleted.
+func (c *CLI) UnconfigureSidecarAndWait(operatorCUE *cuemodule.OperatorCUE, mesh, name string, annotations map[string]string, timeout time.Duration) []string {
+	configObjects, kinds, ok := unconfigureSidecarObjects(operatorCUE, name, annotations)
+	if !ok {
+		return nil
+	}
+
+	cl := c.MeshClient(mesh)
+	if cl == nil {
+		return []string{fmt.Sprintf("sidecar configuration for %s: no greymatter client for mesh %s", name, mesh)}
+	}
+	return DeleteAll(cl, configObjects, kinds, timeout)
+}
+
+// unconfigureSidecarObjects returns the fabric objects to remove for a workload, given its annotations.
+// It returns false if the workload's sidecar was never configured by the operator.
+func unconfigureSidecarObjects(operatorCUE *cuemodule.OperatorCUE, name string, annotations map[string]string) ([]json.RawMessage, []string, bool) {
 	//annotations := metadata.Annotations
 	logger.Info("Unconfiguring sidecar with values", "name", name, "annotations", annotations)
-	injectedSidecarPortString, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
-	var injectedSidecarPort int
-	if injectSidecar {
-		parsedPort, err := strconv.Atoi(injectedSidecarPortString)
-		if err != nil {
-			logger.Error(err, "provided port for sidecar upstream could not be parsed as int", wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT, injectedSidecarPortString)
-			return
-		}
-		injectedSidecarPort = parsedPort
-	} else { // if we're not injecting a sidecar, skip configuration
-		return
+	port, upstreams, injectSidecar, err := cuemodule.ParseUpstreams(annotations)
+	if err != nil {
+		logger.Error(err, "provided upstream ports for sidecar could not be parsed", "name", name)
+		return nil, nil, false
+	}
+	if !injectSidecar { // if we're not injecting a sidecar, skip configuration
+		return nil, nil, false
 	}
 
 	// we also skip configuration if we're explicitly told to
 	configureSidecar := annotations[wellknown.ANNOTATION_CONFIGURE_SIDECAR]
 	if configureSidecar == "false" {
-		return
+		return nil, nil, false
 	}
 
-	configObjects, kinds, err := operatorCUE.UnifyAndExtractSidecarConfig(name, injectedSidecarPort)
+	configObjects, kinds, err := operatorCUE.UnifyAndExtractSidecarConfig(name, port, upstreams...)
 	if err != nil {
-		logger.Error(err, "Failed to unify or extract CUE", "name", name, "injectedSidecarPort", injectedSidecarPort)
+		logger.Error(err, "Failed to unify or extract CUE", "name", name, "injectedSidecarPort", port, "upstreams", upstreams)
 	}
 
-	UnApplyAll(c.Client, configObjects, kinds)
+	return configObjects, kinds, true
 }
@@ -2,34 +2,77 @@ package gmapi
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/greymatter-io/operator/api/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type Client struct {
 	mesh        string
 	flags       []string
+	api         *gmhttp.Client // if set, Cmds are performed with HTTP requests instead of the CLI
 	ControlCmds chan Cmd
 	CatalogCmds chan Cmd
 	Ctx         context.Context
 	Cancel      context.CancelFunc
+	reporter    ConditionReporter
+	inventory   InventoryStore
+
+	// Held while pruning, and while starting an apply of core mesh configs so that it waits for
+	// an in-flight prune instead of having the objects it applies deleted by it.
+	pruneMtx sync.Mutex
+	// Incremented by each apply of core mesh configs; a prune only runs for the latest one.
+	applyGeneration uint64
 }
 
-func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ...string) (*Client, error) {
+// The maximum number of times a failed command is run before it is given up on.
+const maxCmdAttempts = 30
+
+// requeue sends a failed Cmd back to its consumer after 10 seconds, unless it has been attempted
+// maxCmdAttempts times or the Client is cancelled.
+func (client *Client) requeue(ctx context.Context, cmds chan Cmd, c Cmd, response string, err error) {
+	c.attempts++
+	if c.attempts >= maxCmdAttempts {
+		logger.Error(err, "command failed; giving up", "args", c.args, "attempts", c.attempts, "response", response, "Mesh", client.mesh)
+		return
+	}
+	logger.Info("command failed, will reattempt in 10 seconds", "args", c.args, "error", err, "response", response)
+	go func() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+		logger.Info("requeuing failed command", "args", c.args)
+		select {
+		case <-ctx.Done():
+		case cmds <- c:
+		}
+	}()
+}
+
+func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, reporter ConditionReporter, inventory InventoryStore, api *gmhttp.Client, flags ...string) (*Client, error) {
 
 	ctxt, cancel := context.WithCancel(context.Background())
 
 	client := &Client{
 		mesh:        mesh.Name,
 		flags:       flags,
+		api:         api,
 		ControlCmds: make(chan Cmd),
 		CatalogCmds: make(chan Cmd),
 		Ctx:         ctxt,
 		Cancel:      cancel,
+		reporter:    reporter,
+		inventory:   inventory,
 	}
 
 	// Apply core Grey Matter components from CUE
@@ -45,6 +88,7 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 
 		// Ping Control every 5s until responsive by getting and editing the Mesh's zone.
 		// This ensures we can read and write from Control without any errors.
+		attempts := 0
 	PING_CONTROL_LOOP:
 		for {
 			select {
@@ -55,14 +99,24 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 					// Create a NOOP shared_rules object to ensure that we can write to Control.
 					// Using `greymatter create` is required because `greymatter apply` does not exit with an error code on failed actions.
 					args: fmt.Sprintf("create sharedrules --zone-key %s --shared-rules-key %s --name %s", mesh.Spec.Zone, srKey, srKey),
-				}).run(client.flags); err != nil {
+					request: func(ctx context.Context, api *gmhttp.Client, _ json.RawMessage) (json.RawMessage, error) {
+						return api.CreateObject(ctx, "sharedrules", json.RawMessage(fmt.Sprintf(
+							`{"zone_key":%q,"shared_rules_key":%q,"name":%q}`, mesh.Spec.Zone, srKey, srKey)))
+					},
+				}).run(ctx, client.api, client.flags); err != nil {
 					logger.Info("Waiting to connect to Control API", "Mesh", mesh.Name, "Issue", err)
+					if attempts == 0 {
+						client.report(v1alpha1.ConditionControlReachable, metav1.ConditionFalse, "Connecting", err.Error())
+					}
+					attempts++
 					time.Sleep(time.Second * 10)
 					continue PING_CONTROL_LOOP
 				}
 				logger.Info("Connected to Control API",
 					"Mesh", mesh.Name,
 					"Elapsed", time.Since(start).String())
+				client.report(v1alpha1.ConditionControlReachable, metav1.ConditionTrue, "Connected",
+					fmt.Sprintf("Connected after %s", time.Since(start).Round(time.Second)))
 				break PING_CONTROL_LOOP
 			}
 		}
@@ -74,18 +128,8 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 				return
 			case c := <-controlCmds:
 				// Requeue failed commands, since there are likely object dependencies (TODO: check)
-				if response, err := c.run(client.flags); err != nil && c.requeue {
-					logger.Info("command failed, will reattempt in 10 seconds", "args", c.args, "error", err, "response", response)
-					go func(args string) {
-						time.Sleep(10 * time.Second)
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							logger.Info("requeuing failed command", "args", args)
-							controlCmds <- c
-						}
-					}(c.args)
+				if response, err := c.run(ctx, client.api, client.flags); err != nil && c.requeue {
+					client.requeue(ctx, controlCmds, c, response, err)
 				}
 			}
 		}
@@ -96,6 +140,7 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 		start := time.Now()
 
 		// Ping Catalog every 5s until responsive (getting the Mesh's session status with Control).
+		attempts := 0
 	PING_CATALOG_LOOP:
 		for {
 			select {
@@ -104,14 +149,23 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 			default:
 				if _, err := (Cmd{
 					args: fmt.Sprintf("get catalogmesh --mesh-id %s", mesh.Name),
-				}).run(client.flags); err != nil {
+					request: func(ctx context.Context, api *gmhttp.Client, _ json.RawMessage) (json.RawMessage, error) {
+						return api.GetMesh(ctx, mesh.Name)
+					},
+				}).run(ctx, client.api, client.flags); err != nil {
 					logger.Info("Waiting to connect to Catalog API", "Mesh", mesh.Name, "Issue", err)
+					if attempts == 0 {
+						client.report(v1alpha1.ConditionCatalogReachable, metav1.ConditionFalse, "Connecting", err.Error())
+					}
+					attempts++
 					time.Sleep(time.Second * 10)
 					continue PING_CATALOG_LOOP
 				}
 				logger.Info("Connected to Catalog API",
 					"Mesh", mesh.Name,
 					"Elapsed", time.Since(start).String())
+				client.report(v1alpha1.ConditionCatalogReachable, metav1.ConditionTrue, "Connected",
+					fmt.Sprintf("Connected after %s", time.Since(start).Round(time.Second)))
 				break PING_CATALOG_LOOP
 			}
 		}
@@ -123,18 +177,8 @@ func newClient(operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh, flags ..
 				return
 			case c := <-catalogCmds:
 				// Requeue failed commands, since there are likely object dependencies (TODO: check)
-				if response, err := c.run(client.flags); err != nil && c.requeue {
-					logger.Info("command failed, will reattempt in 10 seconds", "args", c.args, "error", err, "response", response)
-					go func(args string) {
-						time.Sleep(10 * time.Second)
-						select {
-						case <-ctx.Done():
-							return
-						default:
-							logger.Info("requeuing failed command", "args", args)
-							catalogCmds <- c
-						}
-					}(c.args)
+				if response, err := c.run(ctx, client.api, client.flags); err != nil && c.requeue {
+					client.requeue(ctx, catalogCmds, c, response, err)
 				}
 			}
 		}
@@ -150,7 +194,77 @@ func ApplyCoreMeshConfigs(client *Client, operatorCUE *cuemodule.OperatorCUE) {
 	meshConfigs, kinds, err := operatorCUE.ExtractCoreMeshConfigs()
 	if err != nil {
 		logger.Error(err, "failed to extract while attempting to apply core components mesh config - ignoring")
+		client.report(v1alpha1.ConditionCoreConfigApplied, metav1.ConditionFalse, "ExtractionFailed", err.Error())
+		return
+	}
+
+	// Track outstanding objects so that we can report once every one of them has been applied.
+	// Failed applies are requeued up to maxCmdAttempts times, so an object stays pending until it succeeds.
+	var mtx sync.Mutex
+	pending := make(map[string]struct{})
+	for i, kind := range kinds {
+		if kind != "" {
+			pending[kind+"/"+objKey(kind, meshConfigs[i])] = struct{}{}
+		}
+	}
+	// Duplicate objects in the CUE are applied once, so count what is actually applied.
+	total := len(pending)
+	logger.Info("Applying core mesh config objects", "Mesh", client.mesh, "Count", total)
+	client.report(v1alpha1.ConditionCoreConfigApplied, metav1.ConditionFalse, "Applying",
+		fmt.Sprintf("Applying %d core mesh config objects", total))
+
+	// Once everything has been applied, delete what was applied before but has since been removed from the CUE.
+	// This runs apart from the consumers, since it sends them commands.
+	// Only the prune of the latest apply runs, so that an older one can't delete what a newer one applied.
+	client.pruneMtx.Lock()
+	generation := atomic.AddUint64(&client.applyGeneration, 1)
+	client.pruneMtx.Unlock()
+	applied := ConfigInventory(meshConfigs, kinds)
+	if len(pending) == 0 {
+		go client.pruneCoreMeshConfigs(generation, applied)
+	}
+
+	applyAll(client, meshConfigs, kinds, func(kind, key string, err error) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		id := kind + "/" + key
+		if _, ok := pending[id]; !ok {
+			return
+		}
+		if err != nil {
+			client.report(v1alpha1.ConditionCoreConfigApplied, metav1.ConditionFalse, "ApplyFailed",
+				fmt.Sprintf("failed to apply %s (%d objects pending): %v", id, len(pending), err))
+			return
+		}
+		delete(pending, id)
+		if len(pending) == 0 {
+			client.report(v1alpha1.ConditionCoreConfigApplied, metav1.ConditionTrue, "Applied",
+				fmt.Sprintf("Applied %d core mesh config objects", total))
+			go client.pruneCoreMeshConfigs(generation, applied)
+		}
+	})
+}
+
+// DeleteCoreMeshConfigs deletes the core Grey Matter configuration for a mesh from Control and Catalog,
+// returning a description of each object that could not be deleted within the timeout.
+func DeleteCoreMeshConfigs(client *Client, operatorCUE *cuemodule.OperatorCUE, timeout time.Duration) []string {
+	meshConfigs, kinds, err := operatorCUE.ExtractCoreMeshConfigs()
+	if err != nil {
+		logger.Error(err, "failed to extract while attempting to delete core components mesh config")
+		return []string{fmt.Sprintf("core mesh configs: %v", err)}
+	}
+	return DeleteAll(client, meshConfigs, kinds, timeout)
+}
+
+// report sends a condition to the Client's ConditionReporter, if it has one.
+func (client *Client) report(conditionType string, status metav1.ConditionStatus, reason, message string) {
+	if client.reporter == nil {
 		return
 	}
-	ApplyAll(client, meshConfigs, kinds)
+	client.reporter(client.mesh, metav1.Condition{
+		Type:    conditionType,
+		Status:  status,
+		Reason:  reason,
+		Message: message,
+	})
 }
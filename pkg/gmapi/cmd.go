@@ -2,17 +2,24 @@ package gmapi
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os/exec"
 	"strings"
+
+	"github.com/greymatter-io/operator/pkg/gmhttp"
 )
 
 type Cmd struct {
 	args  string
 	stdin json.RawMessage
+	// If set, performs the Cmd with the Control and Catalog HTTP APIs instead of the greymatter CLI.
+	request func(ctx context.Context, api *gmhttp.Client, stdin json.RawMessage) (json.RawMessage, error)
 	// Notifies the caller to requeue the Cmd if it fails.
 	requeue bool
+	// How many times the Cmd has failed and been requeued.
+	attempts int
 	// A custom logger; if not set, nothing is logged.
 	log func(string, error)
 	// If set, modifies the output before it is returned.
@@ -21,23 +28,19 @@ type Cmd struct {
 	then *Cmd
 }
 
-func (c Cmd) run(flags []string) (string, error) {
-	args := strings.Split(c.args, " ")
-	if len(flags) > 0 {
-		args = append(flags, args...)
-	}
-
-	command := exec.Command("greymatter", args...)
-	if len(c.stdin) > 0 {
-		command.Stdin = bytes.NewReader(c.stdin)
+// run performs the Cmd with api if it is set and the Cmd supports it, and otherwise with the greymatter CLI.
+func (c Cmd) run(ctx context.Context, api *gmhttp.Client, flags []string) (string, error) {
+	var out []byte
+	var err error
+	if api != nil && c.request != nil {
+		out, err = c.request(ctx, api, c.stdin)
+	} else {
+		out, err = c.exec(flags)
 	}
 
-	out, err := command.CombinedOutput()
 	outStr := string(out)
-
-	// If err is a bad exit code, capture stderr as the error.
 	if err != nil {
-		err = fmt.Errorf(outStr)
+		outStr = err.Error()
 	}
 
 	if err == nil {
@@ -55,7 +58,7 @@ func (c Cmd) run(flags []string) (string, error) {
 		// If Cmd.then is defined, run it next.
 		if err == nil && c.then != nil {
 			c.then.stdin = out
-			return c.then.run(flags)
+			return c.then.run(ctx, api, flags)
 		}
 	}
 
@@ -67,8 +70,41 @@ func (c Cmd) run(flags []string) (string, error) {
 	return outStr, err
 }
 
+// exec runs the Cmd's args with the greymatter CLI.
+func (c Cmd) exec(flags []string) ([]byte, error) {
+	args := strings.Split(c.args, " ")
+	if len(flags) > 0 {
+		args = append(flags, args...)
+	}
+
+	command := exec.Command("greymatter", args...)
+	if len(c.stdin) > 0 {
+		command.Stdin = bytes.NewReader(c.stdin)
+	}
+
+	out, err := command.CombinedOutput()
+
+	// If err is a bad exit code, capture stderr as the error.
+	if err != nil {
+		return out, fmt.Errorf(string(out))
+	}
+	return out, nil
+}
+
+// withResult returns a copy of the Cmd that also passes the result of each run to onResult.
+func (c Cmd) withResult(kind, key string, onResult func(kind, key string, err error)) Cmd {
+	log := c.log
+	c.log = func(out string, err error) {
+		if log != nil {
+			log(out, err)
+		}
+		onResult(kind, key, err)
+	}
+	return c
+}
+
 func cliversion() (string, error) {
-	output, err := (Cmd{args: "--version"}).run(nil)
+	output, err := (Cmd{args: "--version"}).run(context.Background(), nil, nil)
 	if err != nil {
 		return "", err
 	}
@@ -1,8 +1,13 @@
 package gmapi
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/greymatter-io/operator/pkg/gmhttp"
 	"github.com/tidwall/gjson"
 )
 
@@ -12,6 +17,12 @@ func MkApply(kind string, data json.RawMessage) Cmd {
 		args:    fmt.Sprintf("apply -t %s -f -", kind),
 		requeue: true,
 		stdin:   data,
+		request: func(ctx context.Context, api *gmhttp.Client, stdin json.RawMessage) (json.RawMessage, error) {
+			if kind == "catalogservice" {
+				return api.ApplyService(ctx, catalogMeshID(stdin), key, stdin)
+			}
+			return api.ApplyObject(ctx, kind, key, stdin)
+		},
 		log: func(out string, err error) {
 			if err != nil {
 				logger.Error(fmt.Errorf(out), "failed apply", "type", kind, "key", key)
@@ -23,11 +34,20 @@ func MkApply(kind string, data json.RawMessage) Cmd {
 }
 
 func ApplyAll(client *Client, objects []json.RawMessage, kinds []string) {
+	applyAll(client, objects, kinds, nil)
+}
+
+// applyAll sends apply commands for each object, calling onResult (if set) with the outcome of every attempt.
+func applyAll(client *Client, objects []json.RawMessage, kinds []string, onResult func(kind, key string, err error)) {
 	for i, kind := range kinds {
+		cmd := MkApply(kind, objects[i])
+		if onResult != nil {
+			cmd = cmd.withResult(kind, objKey(kind, objects[i]), onResult)
+		}
 		if kind == "catalogservice" { // Catalog is special, because it goes on a different channel
-			client.CatalogCmds <- MkApply(kind, objects[i])
+			client.CatalogCmds <- cmd
 		} else if kind != "" { // Everything else goes to Control
-			client.ControlCmds <- MkApply(kind, objects[i])
+			client.ControlCmds <- cmd
 		} else {
 			// TODO explode
 			logger.Error(nil, "Loaded unexpected object, not recognizable as Grey Matter config", "Object", string(objects[i]))
@@ -48,19 +68,91 @@ func UnApplyAll(client *Client, objects []json.RawMessage, kinds []string) {
 	}
 }
 
+// DeleteAll deletes each object from Control or Catalog in reverse order and waits for the results.
+// It returns a description of each object that could not be deleted within the timeout.
+// Objects that no longer exist are considered deleted.
+func DeleteAll(client *Client, objects []json.RawMessage, kinds []string, timeout time.Duration) (leftovers []string) {
+	leftovers, _ = deleteAll(client, objects, kinds, timeout)
+	return leftovers
+}
+
+// deleteAll implements DeleteAll, also returning the kind/key of each object that was deleted or did not exist.
+func deleteAll(client *Client, objects []json.RawMessage, kinds []string, timeout time.Duration) (leftovers []string, deleted map[string]bool) {
+	deleted = make(map[string]bool)
+	ctx, cancel := context.WithTimeout(client.Ctx, timeout)
+	defer cancel()
+
+	type result struct {
+		id  string
+		err error
+	}
+	// Buffered so that late results don't block the consumer after we've given up waiting.
+	results := make(chan result, len(objects))
+
+	sent := 0
+	for i := len(kinds) - 1; i >= 0; i-- {
+		kind := kinds[i]
+		if kind == "" {
+			logger.Error(nil, "Loaded unexpected object, not recognizable as Grey Matter config - ignoring", "Object", string(objects[i]))
+			continue
+		}
+		key := objKey(kind, objects[i])
+		cmd := mkDelete(kind, objects[i]).withResult(kind, key, func(kind, key string, err error) {
+			results <- result{id: fmt.Sprintf("%s/%s", kind, key), err: err}
+		})
+		cmds := client.ControlCmds
+		if kind == "catalogservice" {
+			cmds = client.CatalogCmds
+		}
+		select {
+		case cmds <- cmd:
+			sent++
+		case <-ctx.Done():
+			leftovers = append(leftovers, fmt.Sprintf("%s/%s: %v", kind, key, ctx.Err()))
+		}
+	}
+
+	for n := 0; n < sent; n++ {
+		select {
+		case r := <-results:
+			if r.err != nil && !isNotFound(r.err) {
+				leftovers = append(leftovers, fmt.Sprintf("%s: %v", r.id, r.err))
+			} else {
+				deleted[r.id] = true
+			}
+		case <-ctx.Done():
+			leftovers = append(leftovers, fmt.Sprintf("%d deletions did not complete: %v", sent-n, ctx.Err()))
+			return leftovers, deleted
+		}
+	}
+
+	return leftovers, deleted
+}
+
+// isNotFound reports whether a failed command's error indicates that the object does not exist.
+func isNotFound(err error) bool {
+	if gmhttp.IsNotFound(err) {
+		return true
+	}
+	// The greymatter CLI only gives us its output.
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "not found") || strings.Contains(msg, "404")
+}
+
 func mkDelete(kind string, data json.RawMessage) Cmd {
 	key := objKey(kind, data)
 	args := fmt.Sprintf("delete %s --%s %s", kind, kindFlag(kind), key)
 	if kind == "catalogservice" {
-		var extracted struct {
-			MeshID string `json:"mesh_id"`
-		}
-		_ = json.Unmarshal(data, &extracted)
-
-		args += fmt.Sprintf(" --mesh-id %s", extracted.MeshID)
+		args += fmt.Sprintf(" --mesh-id %s", catalogMeshID(data))
 	}
 	return Cmd{
 		args: args,
+		request: func(ctx context.Context, api *gmhttp.Client, _ json.RawMessage) (json.RawMessage, error) {
+			if kind == "catalogservice" {
+				return nil, api.DeleteService(ctx, catalogMeshID(data), key)
+			}
+			return nil, api.DeleteObject(ctx, kind, key)
+		},
 		log: func(out string, err error) {
 			if err != nil {
 				logger.Error(fmt.Errorf(out), "failed delete", "type", kind, "key", key)
@@ -71,6 +163,15 @@ func mkDelete(kind string, data json.RawMessage) Cmd {
 	}
 }
 
+// catalogMeshID returns the mesh that a Catalog service entry belongs to.
+func catalogMeshID(data json.RawMessage) string {
+	var extracted struct {
+		MeshID string `json:"mesh_id"`
+	}
+	_ = json.Unmarshal(data, &extracted)
+	return extracted.MeshID
+}
+
 func objKey(kind string, data json.RawMessage) string {
 	key := kindKey(kind)
 	value := gjson.Get(string(data), key)
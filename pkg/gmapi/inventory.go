@@ -0,0 +1,110 @@
+package gmapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
+)
+
+// How long to wait for Control and Catalog to delete stale mesh configuration.
+const pruneTimeout = time.Minute
+
+// InventoryStore persists the Control and Catalog objects applied from the core mesh configs of each mesh,
+// so that those removed from the CUE can be deleted even across operator restarts.
+type InventoryStore interface {
+	LoadConfigInventory(mesh string) ([]v1alpha1.ConfigInventoryEntry, error)
+	SaveConfigInventory(mesh string, inventory []v1alpha1.ConfigInventoryEntry) error
+}
+
+// ConfigInventory returns a ConfigInventoryEntry for each mesh config object.
+func ConfigInventory(objects []json.RawMessage, kinds []string) []v1alpha1.ConfigInventoryEntry {
+	var inventory []v1alpha1.ConfigInventoryEntry
+	for i, kind := range kinds {
+		if kind == "" {
+			continue
+		}
+		entry := v1alpha1.ConfigInventoryEntry{Kind: kind, Key: objKey(kind, objects[i])}
+		if kind == "catalogservice" {
+			entry.MeshID = catalogMeshID(objects[i])
+		}
+		inventory = append(inventory, entry)
+	}
+	return inventory
+}
+
+// GetObject returns the live Control or Catalog object identified by an entry.
+func GetObject(ctx context.Context, api *gmhttp.Client, entry v1alpha1.ConfigInventoryEntry) (json.RawMessage, error) {
+	if entry.Kind == "catalogservice" {
+		return api.GetService(ctx, entry.MeshID, entry.Key)
+	}
+	return api.GetObject(ctx, entry.Kind, entry.Key)
+}
+
+// object returns the minimal mesh config object identifying an entry, e.g. for mkDelete.
+func object(entry v1alpha1.ConfigInventoryEntry) json.RawMessage {
+	obj := map[string]string{kindKey(entry.Kind): entry.Key}
+	if entry.MeshID != "" {
+		obj["mesh_id"] = entry.MeshID
+	}
+	data, _ := json.Marshal(obj)
+	return data
+}
+
+// pruneCoreMeshConfigs deletes the objects in the client's mesh's inventory that are not in applied,
+// then saves applied as its new inventory, along with any stale objects that could not be deleted.
+// It should only be called once every object in applied has been applied, and is skipped if the apply
+// of the given generation has since been superseded or the client has been cancelled.
+func (client *Client) pruneCoreMeshConfigs(generation uint64, applied []v1alpha1.ConfigInventoryEntry) {
+	if client.inventory == nil {
+		return
+	}
+	client.pruneMtx.Lock()
+	defer client.pruneMtx.Unlock()
+	if latest := atomic.LoadUint64(&client.applyGeneration); latest != generation || client.Ctx.Err() != nil {
+		logger.Info("Skipping prune of superseded mesh config apply", "Mesh", client.mesh, "Generation", generation, "Latest", latest)
+		return
+	}
+	previous, err := client.inventory.LoadConfigInventory(client.mesh)
+	if err != nil {
+		logger.Error(err, "failed to load mesh config inventory; not pruning", "Mesh", client.mesh)
+		return
+	}
+
+	current := make(map[v1alpha1.ConfigInventoryEntry]bool, len(applied))
+	for _, entry := range applied {
+		current[entry] = true
+	}
+	var stale []v1alpha1.ConfigInventoryEntry
+	var objects []json.RawMessage
+	var kinds []string
+	for _, entry := range previous {
+		if !current[entry] {
+			stale = append(stale, entry)
+			objects = append(objects, object(entry))
+			kinds = append(kinds, entry.Kind)
+		}
+	}
+
+	inventory := append([]v1alpha1.ConfigInventoryEntry{}, applied...)
+	if len(stale) > 0 {
+		logger.Info("Pruning mesh config objects removed from CUE", "Mesh", client.mesh, "Count", len(stale))
+		leftovers, deleted := deleteAll(client, objects, kinds, pruneTimeout)
+		for _, entry := range stale {
+			if !deleted[fmt.Sprintf("%s/%s", entry.Kind, entry.Key)] {
+				inventory = append(inventory, entry)
+			}
+		}
+		if len(leftovers) > 0 {
+			logger.Error(fmt.Errorf("%v", leftovers), "failed to prune mesh config objects; will retry on the next apply", "Mesh", client.mesh)
+		}
+	}
+
+	if err := client.inventory.SaveConfigInventory(client.mesh, inventory); err != nil {
+		logger.Error(err, "failed to save mesh config inventory", "Mesh", client.mesh)
+	}
+}
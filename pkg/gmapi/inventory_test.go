@@ -0,0 +1,92 @@
+package gmapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+)
+
+type memoryInventory map[string][]v1alpha1.ConfigInventoryEntry
+
+func (m memoryInventory) LoadConfigInventory(mesh string) ([]v1alpha1.ConfigInventoryEntry, error) {
+	return m[mesh], nil
+}
+
+func (m memoryInventory) SaveConfigInventory(mesh string, inventory []v1alpha1.ConfigInventoryEntry) error {
+	m[mesh] = inventory
+	return nil
+}
+
+func TestPruneCoreMeshConfigs(t *testing.T) {
+	applied := ConfigInventory([]json.RawMessage{
+		json.RawMessage(`{"cluster_key": "edge"}`),
+		json.RawMessage(`{"service_id": "edge", "mesh_id": "mesh"}`),
+	}, []string{"cluster", "catalogservice"})
+
+	store := memoryInventory{"mesh": append([]v1alpha1.ConfigInventoryEntry{
+		{Kind: "route", Key: "stale"},
+		{Kind: "listener", Key: "failing"},
+		{Kind: "catalogservice", Key: "old", MeshID: "mesh"},
+	}, applied...)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &Client{
+		mesh:        "mesh",
+		ControlCmds: make(chan Cmd),
+		CatalogCmds: make(chan Cmd),
+		Ctx:         ctx,
+		inventory:   store,
+
+		applyGeneration: 2,
+	}
+
+	// Stand in for Control and Catalog, failing to delete the listener.
+	var mtx sync.Mutex
+	var deleted []string
+	consume := func(cmds chan Cmd) {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case c := <-cmds:
+				var err error
+				if c.args == "delete listener --listener-key failing" {
+					err = errors.New("internal server error")
+				} else {
+					mtx.Lock()
+					deleted = append(deleted, c.args)
+					mtx.Unlock()
+				}
+				c.log("", err)
+			}
+		}
+	}
+	go consume(client.ControlCmds)
+	go consume(client.CatalogCmds)
+
+	// A prune for an apply that has been superseded by a newer one does nothing.
+	before := append([]v1alpha1.ConfigInventoryEntry{}, store["mesh"]...)
+	client.pruneCoreMeshConfigs(1, applied[:1])
+	if len(deleted) > 0 || !reflect.DeepEqual(store["mesh"], before) {
+		t.Fatalf("expected a superseded prune to be skipped, got deletions %v and inventory %v", deleted, store["mesh"])
+	}
+
+	client.pruneCoreMeshConfigs(2, applied)
+
+	sort.Strings(deleted)
+	expected := []string{"delete catalogservice --service-id old --mesh-id mesh", "delete route --route-key stale"}
+	if !reflect.DeepEqual(deleted, expected) {
+		t.Errorf("expected deletions %v, got %v", expected, deleted)
+	}
+	expectedInventory := append(applied, v1alpha1.ConfigInventoryEntry{Kind: "listener", Key: "failing"})
+	if !reflect.DeepEqual(store["mesh"], expectedInventory) {
+		t.Errorf("expected inventory %v, got %v", expectedInventory, store["mesh"])
+	}
+}
@@ -0,0 +1,176 @@
+// Package gmhttp is a client for the Grey Matter Control and Catalog HTTP APIs.
+// It is an alternative to executing greymatter CLI commands, returning structured errors
+// that preserve the status code of each failed request.
+package gmhttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client makes requests to the Control and Catalog APIs of a mesh.
+type Client struct {
+	controlURL string
+	catalogURL string
+	http       *http.Client
+}
+
+// New returns a *Client for the Control and Catalog APIs at the given base URLs.
+// If httpClient is nil, a client with a 30 second timeout is used.
+func New(controlURL, catalogURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{
+		controlURL: strings.TrimSuffix(controlURL, "/"),
+		catalogURL: strings.TrimSuffix(catalogURL, "/"),
+		http:       httpClient,
+	}
+}
+
+// Error is returned for requests that receive a non-2xx response.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s %s: %d %s: %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// IsNotFound reports whether err is an *Error for a 404 response.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is an *Error for a 409 response.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, code int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == code
+}
+
+// CreateObject creates a Control object of the given kind (e.g. "cluster", "listener").
+func (c *Client) CreateObject(ctx context.Context, kind string, obj json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPost, c.controlPath(kind), obj)
+}
+
+// GetObject returns the Control object of the given kind and key.
+func (c *Client) GetObject(ctx context.Context, kind, key string) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, c.controlPath(kind, key), nil)
+}
+
+// UpdateObject replaces the Control object of the given kind and key.
+func (c *Client) UpdateObject(ctx context.Context, kind, key string, obj json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPut, c.controlPath(kind, key), obj)
+}
+
+// DeleteObject deletes the Control object of the given kind and key.
+func (c *Client) DeleteObject(ctx context.Context, kind, key string) error {
+	_, err := c.do(ctx, http.MethodDelete, c.controlPath(kind, key), nil)
+	return err
+}
+
+// ApplyObject updates the Control object of the given kind and key, creating it if it does not exist.
+func (c *Client) ApplyObject(ctx context.Context, kind, key string, obj json.RawMessage) (json.RawMessage, error) {
+	out, err := c.UpdateObject(ctx, kind, key, obj)
+	if IsNotFound(err) {
+		return c.CreateObject(ctx, kind, obj)
+	}
+	return out, err
+}
+
+// CreateService creates a Catalog service entry.
+func (c *Client) CreateService(ctx context.Context, obj json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPost, c.catalogPath("services"), obj)
+}
+
+// GetService returns the Catalog service entry with the given mesh and service IDs.
+func (c *Client) GetService(ctx context.Context, meshID, serviceID string) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, c.catalogPath("services", meshID, serviceID), nil)
+}
+
+// UpdateService replaces the Catalog service entry with the given mesh and service IDs.
+func (c *Client) UpdateService(ctx context.Context, meshID, serviceID string, obj json.RawMessage) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodPut, c.catalogPath("services", meshID, serviceID), obj)
+}
+
+// DeleteService deletes the Catalog service entry with the given mesh and service IDs.
+func (c *Client) DeleteService(ctx context.Context, meshID, serviceID string) error {
+	_, err := c.do(ctx, http.MethodDelete, c.catalogPath("services", meshID, serviceID), nil)
+	return err
+}
+
+// ApplyService updates a Catalog service entry, creating it if it does not exist.
+func (c *Client) ApplyService(ctx context.Context, meshID, serviceID string, obj json.RawMessage) (json.RawMessage, error) {
+	out, err := c.UpdateService(ctx, meshID, serviceID, obj)
+	if IsNotFound(err) {
+		return c.CreateService(ctx, obj)
+	}
+	return out, err
+}
+
+// GetMesh returns the Catalog mesh entry with the given ID.
+func (c *Client) GetMesh(ctx context.Context, meshID string) (json.RawMessage, error) {
+	return c.do(ctx, http.MethodGet, c.catalogPath("meshes", meshID), nil)
+}
+
+func (c *Client) controlPath(kind string, key ...string) string {
+	return c.controlURL + "/v1.0/" + joinPath(append([]string{kind}, key...))
+}
+
+func (c *Client) catalogPath(segments ...string) string {
+	return c.catalogURL + "/" + joinPath(segments)
+}
+
+func joinPath(segments []string) string {
+	escaped := make([]string, len(segments))
+	for i, s := range segments {
+		escaped[i] = url.PathEscape(s)
+	}
+	return strings.Join(escaped, "/")
+}
+
+func (c *Client) do(ctx context.Context, method, u string, body json.RawMessage) (json.RawMessage, error) {
+	var r io.Reader
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s: failed to read response: %w", method, u, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, &Error{Method: method, URL: u, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(out))}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,59 @@
+package gmhttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestApplyObjectCreatesWhenMissing(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch r.Method {
+		case http.MethodPut:
+			http.Error(w, "no such cluster", http.StatusNotFound)
+		case http.MethodPost:
+			w.Write([]byte(`{"cluster_key":"edge"}`))
+		}
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.URL, nil)
+	out, err := c.ApplyObject(context.Background(), "cluster", "edge", json.RawMessage(`{"cluster_key":"edge"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"cluster_key":"edge"}` {
+		t.Errorf("unexpected response: %s", out)
+	}
+
+	expected := []string{"PUT /v1.0/cluster/edge", "POST /v1.0/cluster"}
+	if len(requests) != len(expected) || requests[0] != expected[0] || requests[1] != expected[1] {
+		t.Errorf("expected requests %v, got %v", expected, requests)
+	}
+}
+
+func TestStructuredErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/mesh/catalog" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		http.Error(w, "not found", http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := New(srv.URL, srv.URL+"/", nil)
+	err := c.DeleteService(context.Background(), "mesh", "catalog")
+	if !IsNotFound(err) {
+		t.Fatalf("expected a not found error, got %v", err)
+	}
+	if e := err.(*Error); e.Method != http.MethodDelete || e.Body != "not found" {
+		t.Errorf("unexpected error fields: %+v", e)
+	}
+	if IsConflict(err) {
+		t.Error("expected IsConflict to be false")
+	}
+}
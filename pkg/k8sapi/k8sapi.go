@@ -4,6 +4,8 @@ import (
 	"context"
 
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -15,6 +17,9 @@ var (
 	logger = ctrl.Log.WithName("k8sapi")
 )
 
+// FieldManager identifies the operator as the owner of the fields it sets with server-side apply.
+const FieldManager = "gm-operator"
+
 // ActionFunc is a type of function that makes a sequence of API calls to a K8s apiserver.
 // If any API call fails, the ActionFunc should return a string describing the failed call,
 // plus the error returned by the sigs.k8s.io/controller-runtime/pkg/client.Client.
@@ -86,6 +91,89 @@ func CreateOrUpdate(c client.Client, obj client.Object) (string, error) {
 	return "update", nil
 }
 
+// ServerSideApply is an Action that applies a resource in the K8s apiserver with server-side apply,
+// taking ownership of any fields it sets that conflict with another field manager.
+func ServerSideApply(c client.Client, obj client.Object) (string, error) {
+	return MkServerSideApplyAction(true)(c, obj)
+}
+
+// MkServerSideApplyAction returns an Action that applies a resource with server-side apply as the FieldManager.
+// Unlike CreateOrUpdate, fields the resource does not set are left to other controllers, e.g. an HPA's replica count.
+// If force is false, applying a field owned by another field manager with a different value fails with a conflict.
+func MkServerSideApplyAction(force bool) ActionFunc {
+	return func(c client.Client, obj client.Object) (string, error) {
+		patch, err := applyConfiguration(c.Scheme(), obj)
+		if err != nil {
+			return "server-side apply", err
+		}
+
+		opts := []client.PatchOption{client.FieldOwner(FieldManager)}
+		if force {
+			opts = append(opts, client.ForceOwnership)
+		}
+		if err := c.Patch(context.TODO(), patch, client.Apply, opts...); err != nil {
+			return "server-side apply", err
+		}
+		// Return the applied object to the caller, as Patch would.
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			u.Object = patch.Object
+		} else if err := runtime.DefaultUnstructuredConverter.FromUnstructured(patch.Object, obj); err != nil {
+			return "server-side apply", err
+		}
+		return "server-side apply", nil
+	}
+}
+
+// applyConfiguration returns an object as an apply patch that sets only the fields it has values for,
+// so that the FieldManager doesn't take ownership of the zero values of typed structs, e.g. a null
+// metadata.creationTimestamp or empty resources, nor of server-managed metadata and status.
+func applyConfiguration(scheme *runtime.Scheme, obj client.Object) (*unstructured.Unstructured, error) {
+	// Apply patches must identify their kind.
+	gvk, err := apiutil.GVKForObject(obj, scheme)
+	if err != nil {
+		return nil, err
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	patch := &unstructured.Unstructured{Object: content}
+	patch.SetGroupVersionKind(gvk)
+	patch.SetManagedFields(nil)
+	patch.SetResourceVersion("")
+	delete(patch.Object, "status")
+	pruneEmpty(patch.Object)
+	return patch, nil
+}
+
+// pruneEmpty removes the null values, empty maps, and empty lists nested in a map, including maps and lists
+// that are only empty once pruned.
+func pruneEmpty(m map[string]interface{}) {
+	for k, v := range m {
+		if isEmpty(v) {
+			delete(m, k)
+		}
+	}
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		pruneEmpty(v)
+		return len(v) == 0
+	case []interface{}:
+		for _, item := range v {
+			if m, ok := item.(map[string]interface{}); ok {
+				pruneEmpty(m)
+			}
+		}
+		return len(v) == 0
+	}
+	return false
+}
+
 // GetOrCreate is an Action that ensures a resource exists in the K8s apiserver.
 func GetOrCreate(c client.Client, obj client.Object) (string, error) {
 	key := client.ObjectKeyFromObject(obj)
@@ -117,3 +205,33 @@ func MkPatchAction(patch func(client.Object) client.Object) ActionFunc {
 		return "patch", nil
 	}
 }
+
+// MkStatusPatchAction returns an Action that applies the patch specified to the status subresource when called.
+func MkStatusPatchAction(patch func(client.Object) client.Object) ActionFunc {
+	return func(c client.Client, obj client.Object) (string, error) {
+		key := client.ObjectKeyFromObject(obj)
+		if err := c.Get(context.TODO(), key, obj); err != nil {
+			return "get", err
+		}
+
+		mp := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+		obj = patch(obj)
+		if err := c.Status().Patch(context.TODO(), obj, mp); err != nil {
+			return "patch status", err
+		}
+
+		return "patch status", nil
+	}
+}
+
+// Delete is an Action that removes a resource from the K8s apiserver if it exists.
+func Delete(c client.Client, obj client.Object) (string, error) {
+	if err := c.Delete(context.TODO(), obj, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil {
+		if errors.IsNotFound(err) {
+			return "already deleted", nil
+		}
+		return "delete", err
+	}
+
+	return "delete", nil
+}
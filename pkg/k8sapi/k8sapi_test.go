@@ -0,0 +1,68 @@
+package k8sapi
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+func TestApplyConfiguration(t *testing.T) {
+	replicas := int32(0)
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "edge", Namespace: "greymatter", ResourceVersion: "7"},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{{Name: "edge", Image: "edge:latest"}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{Replicas: 1},
+	}
+
+	patch, err := applyConfiguration(clientgoscheme.Scheme, deployment)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if patch.GetAPIVersion() != "apps/v1" || patch.GetKind() != "Deployment" {
+		t.Errorf("expected apps/v1 Deployment, got %s %s", patch.GetAPIVersion(), patch.GetKind())
+	}
+	for _, path := range [][]string{
+		{"status"},
+		{"metadata", "creationTimestamp"},
+		{"metadata", "resourceVersion"},
+		{"spec", "selector"},
+		{"spec", "strategy"},
+		{"spec", "template", "metadata"},
+	} {
+		if _, ok, _ := unstructured.NestedFieldNoCopy(patch.Object, path...); ok {
+			t.Errorf("expected %v to be pruned", path)
+		}
+	}
+
+	// Zero values that were set are kept.
+	if got, _, _ := unstructured.NestedInt64(patch.Object, "spec", "replicas"); got != 0 {
+		t.Errorf("expected spec.replicas 0, got %d", got)
+	}
+	if _, ok, _ := unstructured.NestedFieldNoCopy(patch.Object, "spec", "replicas"); !ok {
+		t.Error("expected spec.replicas to be kept")
+	}
+
+	containers, _, _ := unstructured.NestedSlice(patch.Object, "spec", "template", "spec", "containers")
+	if len(containers) != 1 {
+		t.Fatalf("expected 1 container, got %d", len(containers))
+	}
+	container := containers[0].(map[string]interface{})
+	if _, ok := container["resources"]; ok {
+		t.Error("expected empty container resources to be pruned")
+	}
+	if container["image"] != "edge:latest" {
+		t.Errorf("expected container image edge:latest, got %v", container["image"])
+	}
+}
@@ -0,0 +1,112 @@
+package mesh_install
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/k8sapi"
+	"github.com/greymatter-io/operator/pkg/plan"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// The most changed fields listed in a DriftCorrected Event.
+const maxDriftPaths = 10
+
+// CorrectDrift re-applies the core manifests of an applied Mesh whose live objects have been changed or deleted
+// outside of the CUE, recording a DriftCorrected Event on each object listing the fields that were reverted.
+// Objects annotated to disable drift correction are left as they are.
+func (i *Installer) CorrectDrift(mesh *v1alpha1.Mesh) error {
+	operatorCUE, _, err := i.loadCUE()
+	if err != nil {
+		cuemodule.LogError(logger, err)
+		return err
+	}
+	if err := operatorCUE.UnifyWithMesh(mesh); err != nil {
+		cuemodule.LogError(logger, err)
+		return err
+	}
+	manifestObjects, err := operatorCUE.ExtractCoreK8sManifests()
+	if err != nil {
+		cuemodule.LogError(logger, err)
+		return err
+	}
+	labelForInventory(mesh, i.Sync.Revision(), manifestObjects)
+
+	var errs []error
+	for _, manifest := range manifestObjects {
+		drifted, err := i.drift(manifest)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", i.describe(manifest), err))
+			continue
+		}
+		if len(drifted) == 0 {
+			continue
+		}
+
+		logger.Info("Correcting drift from CUE", "Mesh", mesh.Name, "Object", i.describe(manifest), "Fields", drifted)
+		if err := k8sapi.Apply(i.K8sClient, manifest, mesh, k8sapi.MkServerSideApplyAction(i.ForceApplyConflicts)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if len(drifted) > maxDriftPaths {
+			drifted = append(drifted[:maxDriftPaths], fmt.Sprintf("and %d more", len(drifted)-maxDriftPaths))
+		}
+		if i.Recorder != nil {
+			i.Recorder.Event(manifest, corev1.EventTypeNormal, "DriftCorrected",
+				fmt.Sprintf("Reverted changes made outside of the CUE: %s", strings.Join(drifted, ", ")))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to correct drift in %d objects: %w", len(errs), utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// drift returns the paths of the fields in a manifest whose live values differ from it,
+// or ["(deleted)"] if the live object no longer exists.
+func (i *Installer) drift(manifest client.Object) ([]string, error) {
+	gvk, err := apiutil.GVKForObject(manifest, (*i.K8sClient).Scheme())
+	if err != nil {
+		return nil, err
+	}
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gvk)
+	if err := (*i.K8sClient).Get(context.TODO(), client.ObjectKeyFromObject(manifest), live); err != nil {
+		if errors.IsNotFound(err) {
+			return []string{"(deleted)"}, nil
+		}
+		return nil, err
+	}
+	if live.GetAnnotations()[wellknown.ANNOTATION_DRIFT_CORRECTION] == "disabled" {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	var desired map[string]interface{}
+	if err := json.Unmarshal(data, &desired); err != nil {
+		return nil, err
+	}
+	delete(desired, "status")
+
+	// The desired object has float64 numbers and the live one int64 numbers; Diff compares them by value.
+	var paths []string
+	for _, change := range plan.Diff(desired, live.Object) {
+		paths = append(paths, change.Path)
+	}
+	return paths, nil
+}
@@ -0,0 +1,67 @@
+package mesh_install
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestDrift(t *testing.T) {
+	configMap := func(name, value string, annotations map[string]string) *corev1.ConfigMap {
+		return testConfigMap(name, map[string]string{"a": value}, nil, annotations)
+	}
+	deployment := func(name string, replicas int32) *appsv1.Deployment {
+		d := testDeployment(name, replicas)
+		d.Spec.Template.Spec.Containers = []corev1.Container{{
+			Name:  "control",
+			Image: "control:1.7",
+			Ports: []corev1.ContainerPort{{Name: "grpc", ContainerPort: 50000}},
+			Resources: corev1.ResourceRequirements{Limits: corev1.ResourceList{
+				corev1.ResourceCPU:    resource.MustParse("500m"),
+				corev1.ResourceMemory: resource.MustParse("1Gi"),
+			}},
+		}}
+		return d
+	}
+	i, _ := newTestInstaller(t,
+		deployment("same-deployment", 2),
+		deployment("scaled-deployment", 3),
+		configMap("same", "1", nil),
+		configMap("edited", "2", nil),
+		configMap("suspended", "2", map[string]string{wellknown.ANNOTATION_DRIFT_CORRECTION: "disabled"}),
+	)
+
+	for name, expected := range map[string][]string{
+		"same":      nil,
+		"edited":    {"data.a"},
+		"suspended": nil,
+		"deleted":   {"(deleted)"},
+	} {
+		drifted, err := i.drift(configMap(name, "1", nil))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(drifted, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, drifted)
+		}
+	}
+
+	// Integer fields such as replicas and ports are not drift unless their values differ.
+	for name, expected := range map[string][]string{
+		"same-deployment":   nil,
+		"scaled-deployment": {"spec.replicas"},
+	} {
+		drifted, err := i.drift(deployment(name, 2))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(drifted, expected) {
+			t.Errorf("%s: expected %v, got %v", name, expected, drifted)
+		}
+	}
+}
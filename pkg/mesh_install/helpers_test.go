@@ -0,0 +1,45 @@
+package mesh_install
+
+import (
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// newTestInstaller returns an Installer backed by a fake client holding objs, along with the client.
+func newTestInstaller(t *testing.T, objs ...client.Object) (*Installer, client.Client) {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	var c client.Client = fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	return &Installer{K8sClient: &c}, c
+}
+
+// testConfigMap returns a ConfigMap in the greymatter namespace.
+func testConfigMap(name string, data, labels, annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "greymatter", Labels: labels, Annotations: annotations},
+		Data:       data,
+	}
+}
+
+// testDeployment returns a Deployment in the greymatter namespace.
+func testDeployment(name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "greymatter"},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
@@ -2,26 +2,89 @@ package mesh_install
 
 import (
 	"context"
+	"fmt"
+	"strings"
+
 	"github.com/greymatter-io/operator/api/v1alpha1"
 	"github.com/greymatter-io/operator/pkg/cuemodule"
 	"github.com/greymatter-io/operator/pkg/gmapi"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
 	"github.com/greymatter-io/operator/pkg/k8sapi"
-	"github.com/greymatter-io/operator/pkg/wellknown"
+	"github.com/greymatter-io/operator/pkg/plan"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
+// How long to wait for Control and Catalog to delete mesh configuration while removing a Mesh.
+const gmConfigDeleteTimeout = 30 * time.Second
+
 // ApplyMesh installs and updates Grey Matter core components and dependencies for a single mesh.
-func (i *Installer) ApplyMesh(prev, mesh *v1alpha1.Mesh) {
+// It returns an error if the mesh could not be fully applied, so that the caller may retry.
+// The outcome is recorded in the Mesh's status.
+func (i *Installer) ApplyMesh(prev, mesh *v1alpha1.Mesh) (err error) {
+	defer func() { i.recordApplyResult(mesh, err) }()
+
 	if prev == nil {
 		logger.Info("Installing Mesh", "Name", mesh.Name)
 	} else {
 		logger.Info("Updating Mesh", "Name", mesh.Name)
 	}
 
+	if i.DryRun {
+		return i.planMesh(mesh)
+	}
+
+	// Continue a rollout in progress for this generation of the Mesh and CUE revision, rather than repeating
+	// everything before it. A rollout that failed stays halted.
+	st := i.rollouts.resume(mesh, i.Sync.Revision())
+	if st == nil {
+		if st, err = i.prepareApply(prev, mesh); err != nil {
+			return err
+		}
+		i.rollouts.start(mesh.Name, st)
+	}
+
+	// Apply the k8s manifests, in phases that each wait for the components before them
+	if err := i.rollout(mesh, st); err != nil {
+		return err
+	}
+	i.rollouts.drop(mesh.Name)
+	operatorCUE, inventory, selected := st.operatorCUE, st.inventory, st.selected
+
+	// Delete what was applied before but has since been removed from the CUE
+	if err := i.prune(mesh, inventory); err != nil {
+		return err
+	}
+
+	if cl := i.MeshClient(mesh.Name); prev != nil && cl != nil {
+		logger.Info("Reapplying mesh configs", "Mesh", mesh.Name)
+		go gmapi.ApplyCoreMeshConfigs(cl, operatorCUE)
+	} else {
+		i.ConfigureMeshClient(mesh, operatorCUE) // Applies the Grey Matter configuration once Control and Catalog are up
+	}
+	previous, _ := i.meshes.get(mesh.Name)
+	i.setApplied(mesh, operatorCUE, selected)
+
+	// Remove namespaces that are no longer selected, e.g. because the selector changed
+	for ns := range previous.selected {
+		if !selected[ns] && !isWatched(mesh, ns) {
+			if leftovers := i.leaveNamespace(mesh, operatorCUE, ns); len(leftovers) > 0 {
+				logger.Info("Namespace left Mesh with leftovers", "Mesh", mesh.Name, "Namespace", ns, "Leftovers", leftovers)
+			}
+		}
+	}
+
+	return nil
+}
+
+// prepareApply creates a Mesh's namespaces and copies its image pull secret, labels its workloads,
+// and extracts its core manifests from freshly loaded CUE, returning a rollout of them that has not yet started.
+func (i *Installer) prepareApply(prev, mesh *v1alpha1.Mesh) (*rolloutState, error) {
 	// Create Namespace and image pull secret if this Mesh is new.
 	if prev == nil {
 		namespace := &v1.Namespace{
@@ -30,14 +93,25 @@ func (i *Installer) ApplyMesh(prev, mesh *v1alpha1.Mesh) {
 				Name: mesh.Spec.InstallNamespace,
 			},
 		}
-		k8sapi.Apply(i.K8sClient, namespace, mesh, k8sapi.GetOrCreate)
+		if err := k8sapi.Apply(i.K8sClient, namespace, mesh, k8sapi.GetOrCreate); err != nil {
+			return nil, err
+		}
 		secret := i.imagePullSecret.DeepCopy()
 		secret.Namespace = mesh.Spec.InstallNamespace
-		k8sapi.Apply(i.K8sClient, secret, mesh, k8sapi.GetOrCreate)
+		if err := k8sapi.Apply(i.K8sClient, secret, mesh, k8sapi.GetOrCreate); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resolve the namespaces selected by the Mesh's labels, in addition to those it lists
+	selected, err := i.selectedNamespaces(mesh)
+	if err != nil {
+		return nil, err
 	}
+	watchNamespaces := meshState{mesh: mesh, selected: selected}.watchNamespaces()
 
 	for _, watchedNS := range mesh.Spec.WatchNamespaces {
-		// Create all watched namespaces, if they don't already exist
+		// Create all listed watched namespaces, if they don't already exist
 		namespace := &v1.Namespace{
 			TypeMeta: metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
 			ObjectMeta: metav1.ObjectMeta{
@@ -45,172 +119,212 @@ func (i *Installer) ApplyMesh(prev, mesh *v1alpha1.Mesh) {
 			},
 		}
 		k8sapi.Apply(i.K8sClient, namespace, mesh, k8sapi.GetOrCreate)
+	}
+	for _, watchedNS := range watchNamespaces {
 		// Copy the imagePullSecret into all watched namespaces
-		secret := i.imagePullSecret.DeepCopy()
-		secret.Namespace = watchedNS
-		k8sapi.Apply(i.K8sClient, secret, mesh, k8sapi.GetOrCreate)
+		i.copyImagePullSecret(mesh, watchedNS)
 	}
 
 	// Label existing deployments and statefulsets in this Mesh's namespaces
-	deployments := &appsv1.DeploymentList{}
-	(*i.K8sClient).List(context.TODO(), deployments)
-	for _, deployment := range deployments.Items {
-		watched := false
-		for _, ns := range mesh.Spec.WatchNamespaces {
-			if deployment.Namespace == ns {
-				watched = true
-				break
-			}
-		}
-		if watched || deployment.Namespace == mesh.Spec.InstallNamespace {
-			if deployment.Annotations == nil {
-				deployment.Annotations = make(map[string]string)
-			}
-			deployment.Annotations[wellknown.ANNOTATION_LAST_APPLIED] = time.Now().String()
-			k8sapi.Apply(i.K8sClient, &deployment, nil, k8sapi.CreateOrUpdate)
-		}
-	}
-	statefulsets := &appsv1.StatefulSetList{}
-	(*i.K8sClient).List(context.TODO(), statefulsets)
-	for _, statefulset := range statefulsets.Items {
-		watched := false
-		for _, ns := range mesh.Spec.WatchNamespaces {
-			if statefulset.Namespace == ns {
-				watched = true
-				break
-			}
-		}
-		if watched || statefulset.Namespace == mesh.Spec.InstallNamespace {
-			if statefulset.Annotations == nil {
-				statefulset.Annotations = make(map[string]string)
-			}
-			statefulset.Annotations[wellknown.ANNOTATION_LAST_APPLIED] = time.Now().String()
-			k8sapi.Apply(i.K8sClient, &statefulset, nil, k8sapi.CreateOrUpdate)
-		}
+	for _, ns := range append([]string{mesh.Spec.InstallNamespace}, watchNamespaces...) {
+		i.touchWorkloads(ns)
 	}
 
-	// If we're updating an existing mesh, we need to reload the CUE before unification to avoid a situation
-	// where the old concrete values conflict with the new ones
-	// TODO once the CRD is removed, this will be redundant because the new CUE will already be reloaded into the Installer
-	if prev != nil {
-		freshLoadOperatorCUE, _, err := cuemodule.LoadAll(i.CueRoot)
-		if err != nil {
-			logger.Error(err, "failed to load CUE during Apply")
-			return
-		}
-		i.OperatorCUE = freshLoadOperatorCUE
+	// Reload the CUE before unification to avoid a situation where the concrete values from a previous
+	// application (or a previous attempt at this one, or another Mesh) conflict with the new ones.
+	operatorCUE, _, err := i.loadCUE()
+	if err != nil {
+		cuemodule.LogError(logger, err)
+		return nil, err
 	}
+
 	// Do unification between the Mesh and K8s CUE here before extraction, and save the unified values
-	err := i.OperatorCUE.UnifyWithMesh(mesh)
+	err = operatorCUE.UnifyWithMesh(mesh)
 	if err != nil {
-		logger.Error(err,
-			"error while attempting to unify provided Mesh resource with loaded CUE",
-			"Mesh", mesh)
-		return
+		cuemodule.LogError(logger, err)
+		return nil, err
 	}
 
 	// Extract 'em
-	manifestObjects, err := i.OperatorCUE.ExtractCoreK8sManifests()
+	manifestObjects, err := operatorCUE.ExtractCoreK8sManifests()
 	if err != nil {
-		logger.Error(err, "failed to extract k8s manifests")
-		return
+		cuemodule.LogError(logger, err)
+		return nil, err
+	}
+
+	// Label the manifests so that they can be pruned once they are removed from the CUE
+	labelForInventory(mesh, i.Sync.Revision(), manifestObjects)
+	inventory, err := i.inventoryOf(manifestObjects)
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply the k8s manifests we just extracted
 	logger.Info("Reapplying k8s manifests")
-	for _, manifest := range manifestObjects {
-		logger.Info("Applying manifest object:",
-			"Name", manifest.GetName(),
-			"Repr", manifest)
+	st, err := i.newRollout(mesh, manifestObjects)
+	if err != nil {
+		return nil, err
+	}
+	st.operatorCUE, st.inventory, st.selected = operatorCUE, inventory, selected
+	return st, nil
+}
 
-		k8sapi.Apply(i.K8sClient, manifest, mesh, k8sapi.CreateOrUpdate)
+// planMesh logs the changes that applying a Mesh would make, and summarizes them in an Event.
+func (i *Installer) planMesh(mesh *v1alpha1.Mesh) error {
+	operatorCUE, _, err := i.loadCUE()
+	if err != nil {
+		cuemodule.LogError(logger, err)
+		return err
+	}
+	if err := operatorCUE.UnifyWithMesh(mesh); err != nil {
+		cuemodule.LogError(logger, err)
+		return err
 	}
 
-	if prev == nil {
-		i.ConfigureMeshClient(mesh) // Synchronously applies the Grey Matter configuration once Control and Catalog are up
-	} else {
-		logger.Info("Reapplying mesh configs")
-		i.EnsureClient("ApplyMesh")
-		go gmapi.ApplyCoreMeshConfigs(i.Client, i.OperatorCUE)
+	controlURL, catalogURL := gmapi.APIURLs(mesh)
+	p, err := plan.Make(context.TODO(), *i.K8sClient, gmhttp.New(controlURL, catalogURL, nil), operatorCUE, mesh)
+	if err != nil {
+		return err
 	}
-	i.Mesh = mesh // set this mesh as THE mesh managed by the operator
+	var b strings.Builder
+	p.WriteText(&b)
+	logger.Info("Planned Mesh changes (dry run)", "Name", mesh.Name, "Plan", b.String())
+	i.recordEvent(mesh, v1.EventTypeNormal, "Planned", fmt.Sprintf("Dry run: %s", p.Summary()))
+	return nil
 }
 
-// RemoveMesh removes all references to a deleted Mesh custom resource.
-// It does not uninstall core components and dependencies, since that is handled
-// by the apiserver when the Mesh custom resource is deleted.
-func (i *Installer) RemoveMesh(mesh *v1alpha1.Mesh) {
+// RemoveMesh tears down a Mesh custom resource that has been marked for deletion.
+// While Control and Catalog are still up, it deletes the mesh's configuration from them. It then removes
+// the image pull secrets copied into the mesh's namespaces, strips mesh labels from watched workloads,
+// and deletes every core component manifest. It returns a description of each object that could not
+// be removed, so that the caller may retry; once nothing is left, all references to the mesh are dropped.
+func (i *Installer) RemoveMesh(mesh *v1alpha1.Mesh) (leftovers []string) {
 	logger.Info("Uninstalling Mesh", "Name", mesh.Name)
 
-	go i.RemoveMeshClient()
-
-	// Reload the starter Mesh CUE so it can be unified with a new one in the future
-	freshLoadOperatorCUE, freshLoadMesh, err := cuemodule.LoadAll(i.CueRoot)
+	// Reproduce what was applied for this mesh from freshly loaded CUE
+	operatorCUE, _, err := i.loadCUE()
 	if err != nil {
 		logger.Error(err, "unable to load fresh CUE from disk while removing mesh - check mesh integrity")
+		return []string{fmt.Sprintf("failed to load CUE: %v", err)}
+	}
+	if err := operatorCUE.UnifyWithMesh(mesh); err != nil {
+		return []string{fmt.Sprintf("failed to unify Mesh with CUE: %v", err)}
+	}
+	manifestObjects, err := operatorCUE.ExtractCoreK8sManifests()
+	if err != nil {
+		logger.Error(err, "failed to extract k8s manifests")
+		return []string{fmt.Sprintf("failed to extract k8s manifests: %v", err)}
 	}
-	i.OperatorCUE = freshLoadOperatorCUE
-	i.Mesh = freshLoadMesh
 
-	// Remove label for existing deployments and statefulsets
+	// Resolve the namespaces selected by the Mesh's labels, in addition to those it lists
+	selected, err := i.selectedNamespaces(mesh)
+	if err != nil {
+		leftovers = append(leftovers, fmt.Sprintf("failed to resolve selected namespaces: %v", err))
+	}
+	watched := meshState{mesh: mesh, selected: selected}
+
+	// Collect the workloads in this Mesh's watched namespaces
+	var workloads []client.Object
 	deployments := &appsv1.DeploymentList{}
-	(*i.K8sClient).List(context.TODO(), deployments)
-	for _, deployment := range deployments.Items {
-		watched := false
-		for _, ns := range mesh.Spec.WatchNamespaces {
-			if deployment.Namespace == ns {
-				watched = true
-				break
-			}
+	if err := (*i.K8sClient).List(context.TODO(), deployments); err != nil {
+		leftovers = append(leftovers, fmt.Sprintf("failed to list deployments: %v", err))
+	}
+	for idx := range deployments.Items {
+		if watched.watches(deployments.Items[idx].Namespace) {
+			workloads = append(workloads, &deployments.Items[idx])
 		}
-		if watched {
-			dirty := false
-			if deployment.Spec.Template.Labels == nil {
-				dirty = true
-				deployment.Spec.Template.Labels = make(map[string]string)
-			}
-			if _, ok := deployment.Spec.Template.Labels[wellknown.LABEL_CLUSTER]; ok {
-				dirty = true
-				delete(deployment.Spec.Template.Labels, wellknown.LABEL_CLUSTER)
-			}
-			if _, ok := deployment.Spec.Template.Labels[wellknown.LABEL_WORKLOAD]; ok {
-				dirty = true
-				delete(deployment.Spec.Template.Labels, wellknown.LABEL_WORKLOAD)
-			}
-			if dirty {
-				k8sapi.Apply(i.K8sClient, &deployment, nil, k8sapi.CreateOrUpdate)
-			}
+	}
+	statefulsets := &appsv1.StatefulSetList{}
+	if err := (*i.K8sClient).List(context.TODO(), statefulsets); err != nil {
+		leftovers = append(leftovers, fmt.Sprintf("failed to list statefulsets: %v", err))
+	}
+	for idx := range statefulsets.Items {
+		if watched.watches(statefulsets.Items[idx].Namespace) {
+			workloads = append(workloads, &statefulsets.Items[idx])
 		}
 	}
 
-	statefulsets := &appsv1.StatefulSetList{}
-	(*i.K8sClient).List(context.TODO(), statefulsets)
-	for _, statefulset := range statefulsets.Items {
-		watched := false
-		for _, ns := range mesh.Spec.WatchNamespaces {
-			if statefulset.Namespace == ns {
-				watched = true
-				break
-			}
+	// Remove sidecar and core mesh configuration from Control and Catalog
+	gmClient := i.MeshClient(mesh.Name)
+	if applied := i.AppliedMesh(mesh.Name); gmClient != nil && applied != nil && applied.UID == mesh.UID {
+		for _, workload := range workloads {
+			annotations := podTemplate(workload).Annotations
+			leftovers = append(leftovers, i.UnconfigureSidecarAndWait(operatorCUE, mesh.Name, workload.GetName(), annotations, gmConfigDeleteTimeout)...)
 		}
-		if watched {
-			dirty := false
-			if statefulset.Spec.Template.Labels == nil {
-				dirty = true
-				statefulset.Spec.Template.Labels = make(map[string]string)
-			}
-			if _, ok := statefulset.Spec.Template.Labels[wellknown.LABEL_CLUSTER]; ok {
-				dirty = true
-				delete(statefulset.Spec.Template.Labels, wellknown.LABEL_CLUSTER)
-			}
-			if _, ok := statefulset.Spec.Template.Labels[wellknown.LABEL_WORKLOAD]; ok {
-				dirty = true
-				delete(statefulset.Spec.Template.Labels, wellknown.LABEL_WORKLOAD)
-			}
-			if dirty {
-				k8sapi.Apply(i.K8sClient, &statefulset, nil, k8sapi.CreateOrUpdate)
-			}
+		leftovers = append(leftovers, gmapi.DeleteCoreMeshConfigs(gmClient, operatorCUE, gmConfigDeleteTimeout)...)
+	} else {
+		logger.Info("No greymatter client for Mesh; skipping removal of mesh configuration from Control and Catalog", "Name", mesh.Name)
+	}
+
+	// Remove the image pull secrets we copied into the mesh's namespaces
+	for _, ns := range append([]string{mesh.Spec.InstallNamespace}, watched.watchNamespaces()...) {
+		if err := i.removeImagePullSecret(mesh, ns); err != nil {
+			leftovers = append(leftovers, err.Error())
+		}
+	}
+
+	// Remove labels from existing deployments and statefulsets
+	for _, workload := range workloads {
+		if err := i.unlabelWorkload(workload); err != nil {
+			leftovers = append(leftovers, err.Error())
+		}
+	}
+
+	// Delete core components in the reverse of the order they were applied
+	for idx := len(manifestObjects) - 1; idx >= 0; idx-- {
+		manifest := manifestObjects[idx]
+		if err := k8sapi.Apply(i.K8sClient, manifest, nil, k8sapi.Delete); err != nil {
+			leftovers = append(leftovers, fmt.Sprintf("%s: %v", i.describe(manifest), err))
+		}
+	}
+
+	if len(leftovers) == 0 {
+		i.ForgetMesh(mesh)
+	}
+
+	return leftovers
+}
+
+// ForgetMesh drops all references to a Mesh that has been removed, so that it may be applied again in the future.
+func (i *Installer) ForgetMesh(mesh *v1alpha1.Mesh) {
+	logger.Info("Forgetting Mesh", "Name", mesh.Name)
+
+	go i.RemoveMeshClient(mesh.Name)
+	i.forget(mesh.Name)
+}
+
+// describe identifies an object by kind and key for reporting.
+func (i *Installer) describe(obj client.Object) string {
+	kind := "Object"
+	if gvk, err := apiutil.GVKForObject(obj, (*i.K8sClient).Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	return fmt.Sprintf("%s %s", kind, client.ObjectKeyFromObject(obj))
+}
+
+func isWatched(mesh *v1alpha1.Mesh, namespace string) bool {
+	for _, ns := range mesh.Spec.WatchNamespaces {
+		if namespace == ns {
+			return true
 		}
 	}
+	return false
+}
+
+func isOwnedBy(obj client.Object, mesh *v1alpha1.Mesh) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == mesh.UID {
+			return true
+		}
+	}
+	return false
+}
 
+func podTemplate(workload client.Object) *v1.PodTemplateSpec {
+	switch w := workload.(type) {
+	case *appsv1.Deployment:
+		return &w.Spec.Template
+	case *appsv1.StatefulSet:
+		return &w.Spec.Template
+	}
+	return &v1.PodTemplateSpec{}
 }
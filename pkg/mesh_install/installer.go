@@ -4,7 +4,6 @@ package mesh_install
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/cloudflare/cfssl/csr"
 	"github.com/greymatter-io/operator/pkg/wellknown"
 	configv1 "github.com/openshift/api/config/v1"
@@ -14,6 +13,7 @@ import (
 	"time"
 
 	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/certrotation"
 	"github.com/greymatter-io/operator/pkg/cfsslsrv"
 	"github.com/greymatter-io/operator/pkg/cuemodule"
 	"github.com/greymatter-io/operator/pkg/gmapi"
@@ -24,8 +24,10 @@ import (
 	networkingv1 "k8s.io/api/networking/v1"
 	extv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 )
 
 var (
@@ -38,6 +40,8 @@ type Installer struct {
 	K8sClient  *client.Client
 
 	cfssl *cfsslsrv.CFSSLServer
+	// Reissues SPIRE's intermediate CA before it expires.
+	rotator *certrotation.Rotator
 
 	// The meshes.greymatter.io CRD, used as an owner when applying cluster-scoped resources.
 	// If the operator is uninstalled on a cluster, owned cluster-scoped resources will be cleaned up.
@@ -45,16 +49,23 @@ type Installer struct {
 	// The Docker image pull secret to create in namespaces where core services are installed.
 	imagePullSecret *corev1.Secret
 
-	// Container for THE mesh (on the way to an experimental 1:1 operator:mesh paradigm)
-	// Contains the default after load
+	// The default Mesh defined in the CUE, applied on start if AutoApplyMesh is configured
 	Mesh *v1alpha1.Mesh
 
-	// Container for all K8s and GM CUE cue.Values
+	// Container for all K8s and GM CUE cue.Values, as loaded before unification with any Mesh
 	OperatorCUE *cuemodule.OperatorCUE
 
+	// The state of each applied Mesh
+	meshes meshStates
+	// The rollout in progress for each Mesh being applied
+	rollouts rollouts
+
 	// Root on disk of the operator CUE. Used for reloading the default configs on teardown
 	CueRoot string
 
+	// Overlays unified with the operator CUE whenever it is loaded from CueRoot
+	Overlays *cuemodule.Overlays
+
 	// Operator config loadable from CUE
 	Config cuemodule.Config
 
@@ -66,27 +77,82 @@ type Installer struct {
 
 	// Sync configuration with access to a callback for updating on git repo changes
 	Sync *sync.Sync
+
+	// Records Events on the Mesh, e.g. for CUE errors. Optional.
+	Recorder record.EventRecorder
+
+	// Whether to take ownership of fields in core manifests that another field manager has set when applying them.
+	ForceApplyConflicts bool
+
+	// How long to wait for the workloads of each rollout phase of core components to become ready.
+	RolloutTimeout time.Duration
+
+	// If true, Meshes are planned instead of applied, and each plan is logged and summarized in an Event.
+	DryRun bool
+
+	// Closed once Start has retrieved the resources needed for applying meshes.
+	ready chan struct{}
+	// Requests for the Mesh reconciler to re-converge a mesh whose spec has not changed,
+	// e.g. when new CUE has been synchronized from the GitOps repository.
+	reconcileRequests *reconcileQueue
 }
 
 // New returns a new *Installer instance for installing Grey Matter components and dependencies.
-func New(c *client.Client, operatorCUE *cuemodule.OperatorCUE, initialMesh *v1alpha1.Mesh, cueRoot string, gmcli *gmapi.CLI, cfssl *cfsslsrv.CFSSLServer, sync *sync.Sync) (*Installer, error) {
-	config, defaults := operatorCUE.ExtractConfig()
-	return &Installer{
+func New(c *client.Client, operatorCUE *cuemodule.OperatorCUE, initialMesh *v1alpha1.Mesh, cueRoot string, overlays *cuemodule.Overlays, gmcli *gmapi.CLI, cfssl *cfsslsrv.CFSSLServer, rotator *certrotation.Rotator, sync *sync.Sync) (*Installer, error) {
+	config, defaults, err := operatorCUE.ExtractConfig()
+	if err != nil {
+		return nil, err
+	}
+	i := &Installer{
 		CLI:         gmcli,
 		K8sClient:   c,
 		cfssl:       cfssl,
+		rotator:     rotator,
 		OperatorCUE: operatorCUE,
 		Mesh:        initialMesh,
 		CueRoot:     cueRoot,
+		Overlays:    overlays,
 		Config:      config,
 		Defaults:    defaults,
 		Sync:        sync,
-	}, nil
+
+		ForceApplyConflicts: true,
+		RolloutTimeout:      DefaultRolloutTimeout,
+
+		ready:             make(chan struct{}),
+		reconcileRequests: newReconcileQueue(),
+	}
+
+	// Report progress connecting to and configuring Control and Catalog in Mesh status.
+	gmcli.ReportCondition = i.reportCondition
+	// Persist the Control and Catalog objects applied for the mesh in its status, so that they can be pruned.
+	gmcli.Inventory = i
+
+	return i, nil
+}
+
+// Ready returns a channel that is closed once the Installer has started and can apply meshes.
+func (i *Installer) Ready() <-chan struct{} {
+	return i.ready
+}
+
+// ReconcileRequests returns a channel of events requesting that a Mesh be reconciled.
+// It is intended as a source for the Mesh reconciler.
+func (i *Installer) ReconcileRequests() <-chan event.GenericEvent {
+	return i.reconcileRequests.out
+}
+
+// requestReconcile asks the Mesh reconciler to re-converge a mesh without blocking the caller,
+// which may itself be a reconciler. Requests for a mesh that is already waiting to be reconciled are coalesced.
+func (i *Installer) requestReconcile(mesh *v1alpha1.Mesh) {
+	i.reconcileRequests.add(mesh)
 }
 
 // Start initializes resources and configurations after controller-manager has launched.
 // It implements the controller-runtime Runnable interface.
 func (i *Installer) Start(ctx context.Context) error {
+	// Send requests to re-converge meshes to the Mesh reconciler until the manager stops.
+	go i.reconcileRequests.run(ctx)
 
 	// Retrieve the operator image secret from the apiserver (block until it's retrieved).
 	// This secret will be re-created in each install namespace and watch namespaces where core services are pulled.
@@ -102,22 +168,21 @@ func (i *Installer) Start(ctx context.Context) error {
 
 	if i.Config.Spire {
 		logger.Info("Attempting to apply spire server-ca secret")
-		spireSecret := &corev1.Secret{
-			TypeMeta: metav1.TypeMeta{
-				Kind:       "Secret",
-				APIVersion: "v1",
-			},
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "server-ca",
-				Namespace: "spire",
-			},
-		}
-		spireSecret, err = injectGeneratedCertificates(spireSecret, i.cfssl)
+		spireSecret, err := i.applySpireServerCA()
 		if err != nil {
 			logger.Error(err, "Error while attempting to apply spire server-ca secret", "secret object", spireSecret)
 			return err
 		}
-		k8sapi.Apply(i.K8sClient, spireSecret, i.owner, k8sapi.CreateOrUpdate)
+		// Reissue the intermediate CA before it expires.
+		if err := i.rotator.Track("spire-intermediate", spireSecret, []byte(spireSecret.StringData["intermediate.crt"]), func() ([]byte, error) {
+			s, err := i.applySpireServerCA()
+			if err != nil {
+				return nil, err
+			}
+			return []byte(s.StringData["intermediate.crt"]), nil
+		}); err != nil {
+			logger.Error(err, "SPIRE intermediate CA will not be rotated")
+		}
 	}
 
 	// Try to get the OpenShift cluster ingress domain if it exists.
@@ -129,7 +194,7 @@ func (i *Installer) Start(ctx context.Context) error {
 		i.clusterIngressDomain = clusterIngressDomain
 	}
 
-	// If this operator's Mesh CR already exists in the environment, load it
+	// If this operator's Mesh CR already exists in the environment, the Mesh reconciler will pick it up.
 	meshAlreadyDeployed := false
 	meshList := &v1alpha1.MeshList{}
 	if err := (*i.K8sClient).List(context.TODO(), meshList); err != nil {
@@ -137,17 +202,7 @@ func (i *Installer) Start(ctx context.Context) error {
 	}
 	for _, mesh := range meshList.Items {
 		if mesh.Name == i.Mesh.Name {
-			logger.Info("Mesh already deployed. Reloading values.", "Name", mesh.Name)
-			i.Mesh = &mesh // load the live version of the mesh
-			// immediately update OperatorCUE and the SidecarList
-			err := i.OperatorCUE.UnifyWithMesh(i.Mesh)
-			if err != nil {
-				logger.Error(err,
-					"error while attempting to unify existing deployed Mesh with Grey Matter mesh configs CUE",
-					"Mesh", mesh)
-				return err
-			}
-			i.ConfigureMeshClient(i.Mesh)
+			logger.Info("Mesh already deployed. Deferring to reconciler.", "Name", mesh.Name)
 			meshAlreadyDeployed = true
 			break
 		}
@@ -156,25 +211,29 @@ func (i *Installer) Start(ctx context.Context) error {
 	// called on completion of a sync cycle if there are new commits
 	i.Sync.OnSyncCompleted = func() error {
 		logger.Info("GitOps repo updated and synchronized. Reapplying configuration...")
-		// reload CUE here
-		_, freshLoadMesh, err := cuemodule.LoadAll(i.CueRoot)
-		if err != nil {
+		if err := i.Reapply(); err != nil {
 			return err
 		}
-		// copy in old mesh dynamic values
-		freshLoadMesh.TypeMeta = i.Mesh.TypeMeta
-		i.Mesh.ObjectMeta.DeepCopyInto(&freshLoadMesh.ObjectMeta)
-
-		i.ApplyMesh(i.Mesh, freshLoadMesh)
-
+		if !i.DryRun {
+			i.recordRevisionResult(sync.Revision{Ref: i.Sync.Ref(), SHA: i.Sync.Revision()}, nil)
+		}
 		return nil
 	}
 
+	// called when new commits fail validation, in which case the last-known-good revision stays active
+	i.Sync.OnSyncFailed = func(rev sync.Revision, err error) {
+		if i.DryRun {
+			logger.Error(err, "GitOps revision rejected (dry run)", "Revision", rev.String())
+			return
+		}
+		i.recordRevisionResult(rev, err)
+	}
+
 	// Immediately apply the default mesh from the CUE if the flag is set and we don't already have a mesh
 	// Then re-apply the mesh whenever the repository is updated (checked by polling)
 	go func() {
 		// initial mesh application
-		if i.Config.AutoApplyMesh && !meshAlreadyDeployed {
+		if i.Config.AutoApplyMesh && !meshAlreadyDeployed && !i.DryRun {
 			logger.Info("Waiting 30 seconds to apply loaded default Mesh resource to cluster.")
 			time.Sleep(30 * time.Second) // Sleep for an arbitrary initial duration
 			for {
@@ -191,14 +250,72 @@ func (i *Installer) Start(ctx context.Context) error {
 		i.Sync.Watch() // Executes its callback (defined above) whenever there are new commits
 	}()
 
-	// If Spire, set up to periodically reconcile the extant sidecars with the Redis listener's allowable subjects
-	if i.Config.Spire {
-		go i.reconcileSidecarListForRedisIngress(i.Mesh)
+	close(i.ready)
+
+	return nil
+}
+
+// Reapply reloads the operator CUE and re-converges each applied Mesh with it,
+// e.g. when new CUE has been synchronized or its overlays have changed.
+func (i *Installer) Reapply() error {
+	_, freshLoadMesh, err := i.loadCUE()
+	if err != nil {
+		return err
+	}
+
+	// Start over any rollout in progress, so that it uses the new configuration once its Mesh is requeued.
+	i.rollouts.reset()
+
+	meshes := i.AppliedMeshes()
+	if i.DryRun {
+		// Nothing is applied in a dry run, so re-plan every Mesh in the cluster instead.
+		if meshes, err = i.listMeshes(); err != nil {
+			return err
+		}
+	}
+	if len(meshes) == 0 {
+		logger.Info("No Mesh has been applied yet; new configuration will be used when one is")
+		return nil
+	}
+
+	for _, mesh := range meshes {
+		// Carry the mesh spec from the CUE into the live Mesh it defines, unless this is a dry run.
+		if mesh.Name == freshLoadMesh.Name && !i.DryRun {
+			err = k8sapi.Apply(i.K8sClient, mesh, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
+				m := obj.(*v1alpha1.Mesh)
+				m.Spec = freshLoadMesh.Spec
+				return m
+			}))
+			if err != nil {
+				return err
+			}
+		}
+
+		// Re-converge even if the spec did not change, since the manifests and mesh configs may have.
+		i.requestReconcile(mesh)
 	}
 
 	return nil
 }
 
+// listMeshes returns every Mesh in the cluster.
+func (i *Installer) listMeshes() ([]*v1alpha1.Mesh, error) {
+	meshList := &v1alpha1.MeshList{}
+	if err := (*i.K8sClient).List(context.TODO(), meshList); err != nil {
+		return nil, err
+	}
+	var meshes []*v1alpha1.Mesh
+	for idx := range meshList.Items {
+		meshes = append(meshes, &meshList.Items[idx])
+	}
+	return meshes, nil
+}
+
+// loadCUE loads the operator CUE from CueRoot with its overlays.
+func (i *Installer) loadCUE() (*cuemodule.OperatorCUE, *v1alpha1.Mesh, error) {
+	return cuemodule.LoadAll(i.CueRoot, i.Overlays.List()...)
+}
+
 // Retrieves the image pull secret in the gm-operator namespace.
 // This retries indefinitely at 30s intervals and will block by design.
 func getImagePullSecret(c *client.Client) *corev1.Secret {
@@ -250,6 +367,25 @@ func isSupportedKubernetesIngressClassPresent(c client.Client) bool {
 	return false
 }
 
+// applySpireServerCA applies the spire/server-ca secret with a newly issued intermediate CA for SPIRE's server.
+func (i *Installer) applySpireServerCA() (*corev1.Secret, error) {
+	spireSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{
+			Kind:       "Secret",
+			APIVersion: "v1",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "server-ca",
+			Namespace: "spire",
+		},
+	}
+	spireSecret, err := injectGeneratedCertificates(spireSecret, i.cfssl)
+	if err != nil {
+		return spireSecret, err
+	}
+	return spireSecret, k8sapi.Apply(i.K8sClient, spireSecret, i.owner, k8sapi.CreateOrUpdate)
+}
+
 func injectGeneratedCertificates(secret *corev1.Secret, cs *cfsslsrv.CFSSLServer) (*corev1.Secret, error) {
 	root := cs.GetRootCA()
 	ca, caKey, err := cs.RequestIntermediateCA(csr.CertificateRequest{
@@ -271,41 +407,46 @@ func injectGeneratedCertificates(secret *corev1.Secret, cs *cfsslsrv.CFSSLServer
 
 	return secret, nil
 }
-func (i *Installer) reconcileSidecarListForRedisIngress(mesh *v1alpha1.Mesh) {
-	var redisListener json.RawMessage
-	var tempOperatorCUE cuemodule.OperatorCUE
-	var err error
-ReconciliationLoop:
+
+// reconcileSidecarListForRedisIngress periodically reconciles the named mesh's Redis listener's allowable
+// subjects with the sidecars in its namespaces, until ctx is cancelled when the mesh is forgotten.
+func (i *Installer) reconcileSidecarListForRedisIngress(ctx context.Context, meshName string) {
+	defaults := i.Defaults
+	defaults.SidecarList = append([]string{}, i.Defaults.SidecarList...)
+	sort.Strings(defaults.SidecarList)
+
 	for {
-		time.Sleep(30 * time.Second)
+		select {
+		case <-ctx.Done():
+			logger.Info("Mesh forgotten - stopping sidecar list reconciliation loop", "Mesh", meshName)
+			return
+		case <-time.After(30 * time.Second):
+		}
+
+		state, ok := i.meshes.get(meshName)
+		if !ok {
+			continue
+		}
+		mesh := state.mesh
+
 		sidecarSet := make(map[string]struct{})
 		// TODO it may be better to do Deployments and StatefulSets (but as a first pass, Pods are far simpler)
-		i.RLock()
 		// List all pods anywhere
 		pods := &corev1.PodList{}
 		(*i.K8sClient).List(context.TODO(), pods)
 		for _, pod := range pods.Items {
 			// Filter to only the relevant namespaces for this mesh
-			watched := false
-			for _, ns := range mesh.Spec.WatchNamespaces {
-				if pod.Namespace == ns {
-					watched = true
-					break
-				}
+			if !state.watches(pod.Namespace) && pod.Namespace != mesh.Spec.InstallNamespace {
+				continue
 			}
-			if watched || pod.Namespace == mesh.Spec.InstallNamespace {
-				// Further filter to only the pods with a sidecar (assumed to have a container with a "proxy" port)
-				for _, container := range pod.Spec.Containers {
-					for _, p := range container.Ports {
-						// TODO don't hard-code the port name, pull it from the CUE
-						// TODO also, seriously? There's got to be a better way to identify sidecars than this
-						if p.Name == "proxy" {
-							if pod.Labels == nil {
-								pod.Labels = make(map[string]string)
-							}
-							if clusterName, ok := pod.Labels[wellknown.LABEL_CLUSTER]; ok {
-								sidecarSet[clusterName] = struct{}{}
-							}
+			// Further filter to only the pods with a sidecar (assumed to have a container with a "proxy" port)
+			for _, container := range pod.Spec.Containers {
+				for _, p := range container.Ports {
+					// TODO don't hard-code the port name, pull it from the CUE
+					// TODO also, seriously? There's got to be a better way to identify sidecars than this
+					if p.Name == "proxy" {
+						if clusterName, ok := pod.Labels[wellknown.LABEL_CLUSTER]; ok {
+							sidecarSet[clusterName] = struct{}{}
 						}
 					}
 				}
@@ -316,39 +457,31 @@ ReconciliationLoop:
 			sidecarList = append(sidecarList, name)
 		}
 		sort.Strings(sidecarList)
-		sort.Strings(i.Defaults.SidecarList)
-		if len(sidecarList) == 0 || reflect.DeepEqual(sidecarList, i.Defaults.SidecarList) {
-			goto LoopEnd
+		if len(sidecarList) == 0 || reflect.DeepEqual(sidecarList, defaults.SidecarList) {
+			continue
 		}
-		logger.Info("The list of sidecars in the environment has changed. Updating Redis ingress for health checks.", "Updated List", sidecarList)
-		i.Defaults.SidecarList = sidecarList
-		tempOperatorCUE, err = i.OperatorCUE.TempGMValueUnifiedWithDefaults(i.Defaults)
+		logger.Info("The list of sidecars in the environment has changed. Updating Redis ingress for health checks.", "Mesh", meshName, "Updated List", sidecarList)
+		defaults.SidecarList = sidecarList
+		tempOperatorCUE, err := state.operatorCUE.TempGMValueUnifiedWithDefaults(defaults)
 		if err != nil {
 			logger.Error(err,
 				"error attempting to unify mesh after sidecarList update - this should never happen - check Mesh integrity",
-				"Mesh", i.Mesh)
-			goto LoopEnd
+				"Mesh", meshName)
+			continue
 		}
-		redisListener, err = tempOperatorCUE.ExtractRedisListener()
+		redisListener, err := tempOperatorCUE.ExtractRedisListener()
 		if err != nil {
 			logger.Error(err,
 				"error extracting redis_listener from CUE - ignoring",
-				"Mesh", i.Mesh)
-			goto LoopEnd
+				"Mesh", meshName)
+			continue
 		}
-		if i.Client != nil {
-			i.Client.ControlCmds <- gmapi.MkApply("listener", redisListener)
-		}
-
-	LoopEnd:
-		if i.Client != nil {
+		if gmClient := i.MeshClient(meshName); gmClient != nil {
 			select {
-			case <-i.Client.Ctx.Done():
-				logger.Info("greymatter client context cancelled - stopping reconciliation loop")
-				break ReconciliationLoop
-			default:
+			case gmClient.ControlCmds <- gmapi.MkApply("listener", redisListener):
+			case <-gmClient.Ctx.Done():
+			case <-ctx.Done():
 			}
 		}
-		i.RUnlock()
 	}
 }
@@ -0,0 +1,151 @@
+package mesh_install
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+)
+
+// meshState is what the Installer holds for each Mesh it has applied.
+// It is replaced rather than modified, so that copies may be read without holding a lock.
+type meshState struct {
+	mesh *v1alpha1.Mesh
+	// The operator CUE unified with the Mesh, e.g. for extracting its sidecars.
+	operatorCUE *cuemodule.OperatorCUE
+	// The namespaces currently selected by the Mesh's watch_namespace_selector.
+	selected map[string]bool
+	// Stops the Mesh's goroutines once it is forgotten.
+	cancel context.CancelFunc
+}
+
+// watches reports whether a namespace is one of the Mesh's watch namespaces, whether listed or selected.
+func (s meshState) watches(namespace string) bool {
+	return isWatched(s.mesh, namespace) || s.selected[namespace]
+}
+
+// watchNamespaces returns the Mesh's listed watch namespaces followed by those selected by its labels, sorted.
+func (s meshState) watchNamespaces() []string {
+	namespaces := append([]string{}, s.mesh.Spec.WatchNamespaces...)
+	var selected []string
+	for ns := range s.selected {
+		if !isWatched(s.mesh, ns) {
+			selected = append(selected, ns)
+		}
+	}
+	sort.Strings(selected)
+	return append(namespaces, selected...)
+}
+
+// meshStates holds the state of each applied Mesh, keyed by its name.
+type meshStates struct {
+	sync.RWMutex
+	byName map[string]meshState
+}
+
+func (m *meshStates) get(name string) (meshState, bool) {
+	m.RLock()
+	defer m.RUnlock()
+	state, ok := m.byName[name]
+	return state, ok
+}
+
+func (m *meshStates) list() []meshState {
+	m.RLock()
+	defer m.RUnlock()
+	states := make([]meshState, 0, len(m.byName))
+	for _, state := range m.byName {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(a, b int) bool { return states[a].mesh.Name < states[b].mesh.Name })
+	return states
+}
+
+// AppliedMesh returns a copy of the named Mesh as it was last applied, or nil if it has not been applied.
+func (i *Installer) AppliedMesh(name string) *v1alpha1.Mesh {
+	if state, ok := i.meshes.get(name); ok {
+		return state.mesh.DeepCopy()
+	}
+	return nil
+}
+
+// AppliedMeshes returns a copy of each applied Mesh, sorted by name.
+func (i *Installer) AppliedMeshes() []*v1alpha1.Mesh {
+	var meshes []*v1alpha1.Mesh
+	for _, state := range i.meshes.list() {
+		meshes = append(meshes, state.mesh.DeepCopy())
+	}
+	return meshes
+}
+
+// MeshFor returns the applied Mesh that is installed in or watches a namespace,
+// along with the operator CUE unified with it. It returns false if there is none.
+func (i *Installer) MeshFor(namespace string) (*v1alpha1.Mesh, *cuemodule.OperatorCUE, bool) {
+	for _, state := range i.meshes.list() {
+		if state.mesh.Spec.InstallNamespace == namespace || state.watches(namespace) {
+			return state.mesh.DeepCopy(), state.operatorCUE, true
+		}
+	}
+	return nil, nil, false
+}
+
+// setApplied records a Mesh as applied with the operator CUE unified with it and the namespaces
+// selected by its labels, starting its goroutines if it has not been applied before.
+func (i *Installer) setApplied(mesh *v1alpha1.Mesh, operatorCUE *cuemodule.OperatorCUE, selected map[string]bool) {
+	i.meshes.Lock()
+	defer i.meshes.Unlock()
+	if i.meshes.byName == nil {
+		i.meshes.byName = make(map[string]meshState)
+	}
+
+	if state, ok := i.meshes.byName[mesh.Name]; ok {
+		state.mesh = mesh.DeepCopy()
+		state.operatorCUE = operatorCUE
+		state.selected = selected
+		i.meshes.byName[mesh.Name] = state
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	i.meshes.byName[mesh.Name] = meshState{mesh: mesh.DeepCopy(), operatorCUE: operatorCUE, selected: selected, cancel: cancel}
+	// If Spire, periodically reconcile the mesh's sidecars with the Redis listener's allowable subjects
+	if i.Config.Spire {
+		go i.reconcileSidecarListForRedisIngress(ctx, mesh.Name)
+	}
+}
+
+// setSelected records whether a namespace is selected by the named Mesh's labels.
+// It returns false if the Mesh is not applied.
+func (i *Installer) setSelected(name, namespace string, selected bool) bool {
+	i.meshes.Lock()
+	defer i.meshes.Unlock()
+	state, ok := i.meshes.byName[name]
+	if !ok {
+		return false
+	}
+	updated := make(map[string]bool, len(state.selected)+1)
+	for ns := range state.selected {
+		updated[ns] = true
+	}
+	if selected {
+		updated[namespace] = true
+	} else {
+		delete(updated, namespace)
+	}
+	state.selected = updated
+	i.meshes.byName[name] = state
+	return true
+}
+
+// forget stops the named Mesh's goroutines and drops its state, including any rollout in progress.
+func (i *Installer) forget(name string) {
+	i.rollouts.drop(name)
+	i.meshes.Lock()
+	defer i.meshes.Unlock()
+	if state, ok := i.meshes.byName[name]; ok {
+		state.cancel()
+		delete(i.meshes.byName, name)
+	}
+}
@@ -0,0 +1,65 @@
+package mesh_install
+
+import (
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestMeshFor(t *testing.T) {
+	mesh := func(name, installNS string, watchNS ...string) *v1alpha1.Mesh {
+		return &v1alpha1.Mesh{
+			ObjectMeta: metav1.ObjectMeta{Name: name, UID: types.UID("uid-" + name)},
+			Spec:       v1alpha1.MeshSpec{InstallNamespace: installNS, WatchNamespaces: watchNS},
+		}
+	}
+	cueA, cueB := &cuemodule.OperatorCUE{}, &cuemodule.OperatorCUE{}
+	i := &Installer{}
+	i.setApplied(mesh("a", "gm-a", "apps-a", "shared-a"), cueA, nil)
+	i.setApplied(mesh("b", "gm-b", "apps-b"), cueB, map[string]bool{"labeled-b": true})
+
+	for namespace, expected := range map[string]string{
+		"gm-a":      "a",
+		"apps-a":    "a",
+		"shared-a":  "a",
+		"gm-b":      "b",
+		"apps-b":    "b",
+		"labeled-b": "b",
+		"other":     "",
+	} {
+		m, operatorCUE, ok := i.MeshFor(namespace)
+		if expected == "" {
+			if ok {
+				t.Errorf("expected no mesh for namespace %s, got %s", namespace, m.Name)
+			}
+			continue
+		}
+		if !ok || m.Name != expected {
+			t.Errorf("expected mesh %s for namespace %s, got %v", expected, namespace, m)
+			continue
+		}
+		if (expected == "a") != (operatorCUE == cueA) {
+			t.Errorf("expected the CUE unified with mesh %s for namespace %s", expected, namespace)
+		}
+	}
+
+	i.forget("a")
+	if i.AppliedMesh("a") != nil {
+		t.Error("expected mesh a to be forgotten")
+	}
+	if _, _, ok := i.MeshFor("apps-a"); ok {
+		t.Error("expected no mesh for namespace apps-a once mesh a is forgotten")
+	}
+	if m := i.AppliedMesh("b"); m == nil || m.UID != "uid-b" {
+		t.Errorf("expected mesh b to remain applied, got %v", m)
+	}
+
+	i.setSelected("b", "labeled-b", false)
+	if _, _, ok := i.MeshFor("labeled-b"); ok {
+		t.Error("expected no mesh for namespace labeled-b once it is no longer selected")
+	}
+}
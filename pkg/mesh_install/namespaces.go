@@ -0,0 +1,242 @@
+package mesh_install
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/k8sapi"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// selectedNamespaces returns the namespaces selected by a Mesh's watch_namespace_selector, if it has one.
+// Namespaces being deleted and those claimed by any Mesh (see claimedNamespaces) are never selected.
+func (i *Installer) selectedNamespaces(mesh *v1alpha1.Mesh) (map[string]bool, error) {
+	if mesh.Spec.WatchNamespaceSelector == nil {
+		return nil, nil
+	}
+	selector, err := metav1.LabelSelectorAsSelector(mesh.Spec.WatchNamespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watch_namespace_selector: %w", err)
+	}
+	meshes, err := i.listMeshes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list meshes to resolve watch_namespace_selector: %w", err)
+	}
+	namespaces := &corev1.NamespaceList{}
+	if err := (*i.K8sClient).List(context.TODO(), namespaces, client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list namespaces selected by watch_namespace_selector: %w", err)
+	}
+	claimed := i.claimedNamespaces(mesh, meshes)
+	selected := make(map[string]bool)
+	for _, ns := range namespaces.Items {
+		if selects(selector, &ns, claimed) {
+			selected[ns.Name] = true
+		}
+	}
+	return selected, nil
+}
+
+// claimedNamespaces returns the namespaces that a Mesh's watch_namespace_selector may not select:
+// the install namespace of every Mesh, and the namespaces that every other Mesh lists or has selected.
+func (i *Installer) claimedNamespaces(mesh *v1alpha1.Mesh, meshes []*v1alpha1.Mesh) map[string]bool {
+	claimed := map[string]bool{mesh.Spec.InstallNamespace: true}
+	for _, m := range meshes {
+		claimed[m.Spec.InstallNamespace] = true
+		if m.Name != mesh.Name {
+			for _, ns := range m.Spec.WatchNamespaces {
+				claimed[ns] = true
+			}
+		}
+	}
+	for _, state := range i.meshes.list() {
+		claimed[state.mesh.Spec.InstallNamespace] = true
+		if state.mesh.Name != mesh.Name {
+			for _, ns := range state.watchNamespaces() {
+				claimed[ns] = true
+			}
+		}
+	}
+	return claimed
+}
+
+func selects(selector labels.Selector, ns *corev1.Namespace, claimed map[string]bool) bool {
+	return ns.DeletionTimestamp.IsZero() &&
+		!claimed[ns.Name] &&
+		selector.Matches(labels.Set(ns.Labels))
+}
+
+// ReconcileNamespace has a namespace join or leave each applied Mesh whose watch_namespace_selector
+// has started or stopped selecting it since the Mesh was applied. A namespace that no longer exists leaves.
+func (i *Installer) ReconcileNamespace(name string) error {
+	ns := &corev1.Namespace{}
+	if err := (*i.K8sClient).Get(context.TODO(), client.ObjectKey{Name: name}, ns); err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		ns = nil
+	}
+	meshes, err := i.listMeshes()
+	if err != nil {
+		return err
+	}
+
+	// Meshes are visited in order of name, so of two whose selectors match a namespace, the first claims it.
+	for _, state := range i.meshes.list() {
+		mesh := state.mesh
+		if mesh.Spec.WatchNamespaceSelector == nil || isWatched(mesh, name) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(mesh.Spec.WatchNamespaceSelector)
+		if err != nil {
+			continue
+		}
+
+		wanted := ns != nil && selects(selector, ns, i.claimedNamespaces(mesh, meshes))
+		if wanted == state.selected[name] || !i.setSelected(mesh.Name, name, wanted) {
+			continue
+		}
+		if wanted {
+			logger.Info("Namespace joined Mesh", "Mesh", mesh.Name, "Namespace", name)
+			i.joinNamespace(mesh, name)
+			i.recordEvent(mesh, corev1.EventTypeNormal, "NamespaceJoined",
+				fmt.Sprintf("Namespace %s was selected by watch_namespace_selector", name))
+		} else {
+			logger.Info("Namespace left Mesh", "Mesh", mesh.Name, "Namespace", name)
+			leftovers := i.leaveNamespace(mesh, state.operatorCUE, name)
+			msg := fmt.Sprintf("Namespace %s is no longer selected by watch_namespace_selector", name)
+			if len(leftovers) > 0 {
+				i.recordEvent(mesh, corev1.EventTypeWarning, "NamespaceLeft",
+					truncateMessage(fmt.Sprintf("%s; failed to remove: %v", msg, leftovers)))
+			} else {
+				i.recordEvent(mesh, corev1.EventTypeNormal, "NamespaceLeft", msg)
+			}
+		}
+	}
+	return nil
+}
+
+// joinNamespace brings a namespace's workloads into a Mesh by copying the image pull secret into it and
+// touching its Deployments and StatefulSets, so that the workload webhook labels them and configures their sidecars.
+func (i *Installer) joinNamespace(mesh *v1alpha1.Mesh, namespace string) {
+	i.copyImagePullSecret(mesh, namespace)
+	i.touchWorkloads(namespace)
+}
+
+// leaveNamespace removes a namespace's workloads from a Mesh by removing their sidecars' configuration
+// from Control and Catalog, stripping their mesh labels, and deleting the image pull secret copied into it.
+// It returns a description of each object that could not be removed.
+func (i *Installer) leaveNamespace(mesh *v1alpha1.Mesh, operatorCUE *cuemodule.OperatorCUE, namespace string) (leftovers []string) {
+	workloads, err := i.workloadsIn(namespace)
+	if err != nil {
+		leftovers = append(leftovers, err.Error())
+	}
+	for _, workload := range workloads {
+		annotations := podTemplate(workload).Annotations
+		leftovers = append(leftovers, i.UnconfigureSidecarAndWait(operatorCUE, mesh.Name, workload.GetName(), annotations, gmConfigDeleteTimeout)...)
+		if err := i.unlabelWorkload(workload); err != nil {
+			leftovers = append(leftovers, err.Error())
+		}
+	}
+	if err := i.removeImagePullSecret(mesh, namespace); err != nil {
+		leftovers = append(leftovers, err.Error())
+	}
+	return leftovers
+}
+
+// copyImagePullSecret copies the operator's image pull secret into a namespace, if it isn't already there.
+func (i *Installer) copyImagePullSecret(mesh *v1alpha1.Mesh, namespace string) {
+	secret := i.imagePullSecret.DeepCopy()
+	secret.Namespace = namespace
+	k8sapi.Apply(i.K8sClient, secret, mesh, k8sapi.GetOrCreate)
+}
+
+// removeImagePullSecret deletes the image pull secret copied into a namespace for a Mesh, if any.
+func (i *Installer) removeImagePullSecret(mesh *v1alpha1.Mesh, namespace string) error {
+	secret := &corev1.Secret{}
+	key := client.ObjectKey{Name: i.imagePullSecret.Name, Namespace: namespace}
+	if err := (*i.K8sClient).Get(context.TODO(), key, secret); err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("Secret %s: %w", key, err)
+		}
+		return nil
+	}
+	if !isOwnedBy(secret, mesh) {
+		return nil
+	}
+	if err := k8sapi.Apply(i.K8sClient, secret, nil, k8sapi.Delete); err != nil {
+		return fmt.Errorf("Secret %s: %w", key, err)
+	}
+	return nil
+}
+
+// workloadsIn returns the Deployments and StatefulSets in a namespace.
+func (i *Installer) workloadsIn(namespace string) ([]client.Object, error) {
+	var workloads []client.Object
+	deployments := &appsv1.DeploymentList{}
+	if err := (*i.K8sClient).List(context.TODO(), deployments, client.InNamespace(namespace)); err != nil {
+		return nil, fmt.Errorf("failed to list deployments in %s: %w", namespace, err)
+	}
+	for idx := range deployments.Items {
+		workloads = append(workloads, &deployments.Items[idx])
+	}
+	statefulsets := &appsv1.StatefulSetList{}
+	if err := (*i.K8sClient).List(context.TODO(), statefulsets, client.InNamespace(namespace)); err != nil {
+		return workloads, fmt.Errorf("failed to list statefulsets in %s: %w", namespace, err)
+	}
+	for idx := range statefulsets.Items {
+		workloads = append(workloads, &statefulsets.Items[idx])
+	}
+	return workloads, nil
+}
+
+// touchWorkloads annotates the Deployments and StatefulSets in a namespace with the time,
+// so that the workload webhook labels them and configures their sidecars.
+func (i *Installer) touchWorkloads(namespace string) {
+	workloads, err := i.workloadsIn(namespace)
+	if err != nil {
+		logger.Error(err, "failed to list workloads to label", "Namespace", namespace)
+	}
+	for _, workload := range workloads {
+		annotations := workload.GetAnnotations()
+		if annotations == nil {
+			annotations = make(map[string]string)
+		}
+		annotations[wellknown.ANNOTATION_LAST_APPLIED] = time.Now().String()
+		workload.SetAnnotations(annotations)
+		k8sapi.Apply(i.K8sClient, workload, nil, k8sapi.CreateOrUpdate)
+	}
+}
+
+// unlabelWorkload strips the labels added by the workload webhook from a workload's pod template.
+func (i *Installer) unlabelWorkload(workload client.Object) error {
+	tmpl := podTemplate(workload)
+	dirty := false
+	if tmpl.Labels == nil {
+		dirty = true
+		tmpl.Labels = make(map[string]string)
+	}
+	if _, ok := tmpl.Labels[wellknown.LABEL_CLUSTER]; ok {
+		dirty = true
+		delete(tmpl.Labels, wellknown.LABEL_CLUSTER)
+	}
+	if _, ok := tmpl.Labels[wellknown.LABEL_WORKLOAD]; ok {
+		dirty = true
+		delete(tmpl.Labels, wellknown.LABEL_WORKLOAD)
+	}
+	if dirty {
+		if err := k8sapi.Apply(i.K8sClient, workload, nil, k8sapi.CreateOrUpdate); err != nil {
+			return fmt.Errorf("%s: %v", i.describe(workload), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package mesh_install
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestReconcileNamespace(t *testing.T) {
+	mesh := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh", UID: "uid"},
+		Spec: v1alpha1.MeshSpec{
+			InstallNamespace:       "greymatter",
+			WatchNamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"mesh": "yes"}},
+		},
+	}
+	team := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team", Labels: map[string]string{"mesh": "yes"}}}
+	app := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team"}}
+	i, c := newTestInstaller(t, mesh, team, app)
+	i.imagePullSecret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "gm-docker-secret"}}
+	i.setApplied(mesh, nil, nil)
+
+	// The namespace is labeled, so it joins.
+	if err := i.ReconcileNamespace("team"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := i.MeshFor("team"); !ok {
+		t.Fatal("expected namespace team to join the mesh")
+	}
+	if err := c.Get(context.TODO(), client.ObjectKey{Namespace: "team", Name: "gm-docker-secret"}, &corev1.Secret{}); err != nil {
+		t.Errorf("expected image pull secret to be copied into namespace team: %v", err)
+	}
+	if err := c.Get(context.TODO(), client.ObjectKeyFromObject(app), app); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := app.Annotations[wellknown.ANNOTATION_LAST_APPLIED]; !ok {
+		t.Error("expected Deployment app to be touched for the workload webhook")
+	}
+
+	// The label is removed, so it leaves.
+	team.Labels = nil
+	if err := c.Update(context.TODO(), team); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ReconcileNamespace("team"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := i.MeshFor("team"); ok {
+		t.Error("expected namespace team to leave the mesh")
+	}
+	err := c.Get(context.TODO(), client.ObjectKey{Namespace: "team", Name: "gm-docker-secret"}, &corev1.Secret{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("expected image pull secret to be removed from namespace team, got %v", err)
+	}
+}
+
+func TestSelectedNamespaces(t *testing.T) {
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"mesh": "yes"}}
+	mesh := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh"},
+		Spec:       v1alpha1.MeshSpec{InstallNamespace: "greymatter", WatchNamespaceSelector: selector},
+	}
+	other := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "other"},
+		Spec:       v1alpha1.MeshSpec{InstallNamespace: "other", WatchNamespaces: []string{"listed"}},
+	}
+	third := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "third"},
+		Spec:       v1alpha1.MeshSpec{InstallNamespace: "third", WatchNamespaceSelector: selector},
+	}
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"mesh": "yes"}}}
+	}
+	i, _ := newTestInstaller(t,
+		mesh, other, third,
+		namespace("team"), namespace("greymatter"), namespace("other"), namespace("listed"), namespace("taken"),
+	)
+	i.setApplied(third, nil, map[string]bool{"taken": true})
+
+	// Install namespaces and namespaces watched by another Mesh are never selected.
+	selected, err := i.selectedNamespaces(mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]bool{"team": true}; !reflect.DeepEqual(selected, expected) {
+		t.Errorf("expected %v, got %v", expected, selected)
+	}
+}
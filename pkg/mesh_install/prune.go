@@ -0,0 +1,148 @@
+package mesh_install
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/k8sapi"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Characters that may not appear in a label value.
+var invalidLabelChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// inventoryID returns a label value identifying the CUE revision that objects are applied from.
+func inventoryID(revision string) string {
+	if revision == "" {
+		return "local"
+	}
+	id := invalidLabelChars.ReplaceAllString(revision, "-")
+	if len(id) > 63 {
+		id = id[len(id)-63:]
+	}
+	return id
+}
+
+// labelForInventory labels manifests with the Mesh they are applied for and the CUE revision they are applied from.
+func labelForInventory(mesh *v1alpha1.Mesh, revision string, manifests []client.Object) {
+	id := inventoryID(revision)
+	for _, manifest := range manifests {
+		labels := manifest.GetLabels()
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[wellknown.LABEL_MESH] = mesh.Name
+		labels[wellknown.LABEL_INVENTORY] = id
+		manifest.SetLabels(labels)
+	}
+}
+
+// inventoryOf returns an InventoryEntry for each manifest.
+func (i *Installer) inventoryOf(manifests []client.Object) ([]v1alpha1.InventoryEntry, error) {
+	var inventory []v1alpha1.InventoryEntry
+	for _, manifest := range manifests {
+		gvk, err := apiutil.GVKForObject(manifest, (*i.K8sClient).Scheme())
+		if err != nil {
+			return nil, err
+		}
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		inventory = append(inventory, v1alpha1.InventoryEntry{
+			APIVersion: apiVersion,
+			Kind:       kind,
+			Namespace:  manifest.GetNamespace(),
+			Name:       manifest.GetName(),
+		})
+	}
+	return inventory, nil
+}
+
+// prune deletes the objects in a Mesh's inventory that are not among those just applied, then records
+// the new inventory in its status. Objects that are no longer labeled for the Mesh are dropped from the
+// inventory, and objects annotated to be protected from pruning, or that could not be deleted, are kept in it.
+func (i *Installer) prune(mesh *v1alpha1.Mesh, applied []v1alpha1.InventoryEntry) error {
+	current := make(map[v1alpha1.InventoryEntry]bool, len(applied))
+	for _, entry := range applied {
+		current[entry] = true
+	}
+
+	inventory := append([]v1alpha1.InventoryEntry{}, applied...)
+	var errs []error
+	for _, entry := range mesh.Status.Inventory {
+		if current[entry] {
+			continue
+		}
+		desc := fmt.Sprintf("%s %s", entry.Kind, client.ObjectKey{Namespace: entry.Namespace, Name: entry.Name})
+
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(schema.FromAPIVersionAndKind(entry.APIVersion, entry.Kind))
+		key := client.ObjectKey{Namespace: entry.Namespace, Name: entry.Name}
+		if err := (*i.K8sClient).Get(context.TODO(), key, obj); err != nil {
+			if !errors.IsNotFound(err) {
+				inventory = append(inventory, entry)
+				errs = append(errs, fmt.Errorf("%s: %w", desc, err))
+			}
+			continue
+		}
+		if obj.GetLabels()[wellknown.LABEL_MESH] != mesh.Name {
+			continue
+		}
+
+		switch obj.GetAnnotations()[wellknown.ANNOTATION_PRUNE] {
+		case "disabled":
+			logger.Info("Not pruning object removed from CUE; pruning is disabled for it", "Mesh", mesh.Name, "Object", desc)
+			inventory = append(inventory, entry)
+			continue
+		case "dry-run":
+			logger.Info("Would prune object removed from CUE", "Mesh", mesh.Name, "Object", desc)
+			i.recordEvent(mesh, corev1.EventTypeNormal, "PruneDryRun", fmt.Sprintf("%s would be pruned", desc))
+			inventory = append(inventory, entry)
+			continue
+		}
+
+		if err := k8sapi.Apply(i.K8sClient, obj, nil, k8sapi.Delete); err != nil {
+			inventory = append(inventory, entry)
+			errs = append(errs, fmt.Errorf("%s: %w", desc, err))
+			continue
+		}
+		i.recordEvent(mesh, corev1.EventTypeNormal, "Pruned", fmt.Sprintf("%s was removed from the CUE and has been deleted", desc))
+	}
+
+	i.patchMeshStatus(mesh.Name, func(m *v1alpha1.Mesh) {
+		m.Status.Inventory = inventory
+	})
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to prune %d objects: %w", len(errs), utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// LoadConfigInventory implements gmapi.InventoryStore by reading the named Mesh's config inventory from its status.
+func (i *Installer) LoadConfigInventory(meshName string) ([]v1alpha1.ConfigInventoryEntry, error) {
+	mesh := &v1alpha1.Mesh{}
+	if err := (*i.K8sClient).Get(context.TODO(), client.ObjectKey{Name: meshName}, mesh); err != nil {
+		return nil, err
+	}
+	return mesh.Status.ConfigInventory, nil
+}
+
+// SaveConfigInventory implements gmapi.InventoryStore by recording the named Mesh's config inventory in its status.
+func (i *Installer) SaveConfigInventory(meshName string, inventory []v1alpha1.ConfigInventoryEntry) error {
+	mesh := &v1alpha1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: meshName}}
+	return k8sapi.Apply(i.K8sClient, mesh, nil, k8sapi.MkStatusPatchAction(func(obj client.Object) client.Object {
+		m := obj.(*v1alpha1.Mesh)
+		m.Status.ConfigInventory = inventory
+		return m
+	}))
+}
@@ -0,0 +1,82 @@
+package mesh_install
+
+import (
+	"context"
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPrune(t *testing.T) {
+	entry := func(name string) v1alpha1.InventoryEntry {
+		return v1alpha1.InventoryEntry{APIVersion: "v1", Kind: "ConfigMap", Namespace: "greymatter", Name: name}
+	}
+	ours := map[string]string{wellknown.LABEL_MESH: "mesh"}
+
+	mesh := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh"},
+		Status: v1alpha1.MeshStatus{Inventory: []v1alpha1.InventoryEntry{
+			entry("kept"), entry("removed"), entry("protected"), entry("dry-run"), entry("relabeled"), entry("gone"),
+		}},
+	}
+	i, c := newTestInstaller(t,
+		mesh,
+		testConfigMap("kept", nil, ours, nil),
+		testConfigMap("removed", nil, ours, nil),
+		testConfigMap("protected", nil, ours, map[string]string{wellknown.ANNOTATION_PRUNE: "disabled"}),
+		testConfigMap("dry-run", nil, ours, map[string]string{wellknown.ANNOTATION_PRUNE: "dry-run"}),
+		testConfigMap("relabeled", nil, nil, nil),
+	)
+
+	if err := i.prune(mesh, []v1alpha1.InventoryEntry{entry("kept")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, exists := range map[string]bool{
+		"kept":      true,
+		"removed":   false,
+		"protected": true,
+		"dry-run":   true,
+		"relabeled": true,
+	} {
+		err := c.Get(context.TODO(), client.ObjectKey{Namespace: "greymatter", Name: name}, &corev1.ConfigMap{})
+		if exists && err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		} else if !exists && !errors.IsNotFound(err) {
+			t.Errorf("expected %s to be pruned, got %v", name, err)
+		}
+	}
+
+	updated := &v1alpha1.Mesh{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "mesh"}, updated); err != nil {
+		t.Fatal(err)
+	}
+	expected := []v1alpha1.InventoryEntry{entry("kept"), entry("protected"), entry("dry-run")}
+	if len(updated.Status.Inventory) != len(expected) {
+		t.Fatalf("expected inventory %v, got %v", expected, updated.Status.Inventory)
+	}
+	for idx := range expected {
+		if updated.Status.Inventory[idx] != expected[idx] {
+			t.Errorf("expected inventory %v, got %v", expected, updated.Status.Inventory)
+			break
+		}
+	}
+}
+
+func TestInventoryID(t *testing.T) {
+	for revision, expected := range map[string]string{
+		"":    "local",
+		"abc": "abc",
+		"sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef": "123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+	} {
+		if actual := inventoryID(revision); actual != expected {
+			t.Errorf("%q: expected %q, got %q", revision, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package mesh_install
+
+import (
+	"context"
+	"sync"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+// reconcileQueue holds requests for the Mesh reconciler to re-converge meshes whose specs have not changed,
+// coalescing those for the same Mesh so that a burst of them is sent once by a single goroutine.
+type reconcileQueue struct {
+	sync.Mutex
+	// The latest requested copy of each pending Mesh, keyed by name, and their names in the order requested.
+	pending map[string]*v1alpha1.Mesh
+	order   []string
+	// Wakes the sender when a request is added.
+	wake chan struct{}
+	// Receives the requests, as the source for the Mesh reconciler.
+	out chan event.GenericEvent
+}
+
+func newReconcileQueue() *reconcileQueue {
+	return &reconcileQueue{
+		pending: make(map[string]*v1alpha1.Mesh),
+		wake:    make(chan struct{}, 1),
+		out:     make(chan event.GenericEvent),
+	}
+}
+
+// add queues a request without blocking, replacing any request for the same Mesh that has not yet been sent.
+func (q *reconcileQueue) add(mesh *v1alpha1.Mesh) {
+	q.Lock()
+	if _, ok := q.pending[mesh.Name]; !ok {
+		q.order = append(q.order, mesh.Name)
+	}
+	q.pending[mesh.Name] = mesh
+	q.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next removes and returns the oldest pending request, or nil if there is none.
+func (q *reconcileQueue) next() *v1alpha1.Mesh {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.order) == 0 {
+		return nil
+	}
+	name := q.order[0]
+	q.order = q.order[1:]
+	mesh := q.pending[name]
+	delete(q.pending, name)
+	return mesh
+}
+
+// run sends pending requests until ctx is done.
+func (q *reconcileQueue) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+		for mesh := q.next(); mesh != nil; mesh = q.next() {
+			select {
+			case <-ctx.Done():
+				return
+			case q.out <- event.GenericEvent{Object: mesh}:
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package mesh_install
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReconcileQueue(t *testing.T) {
+	q := newReconcileQueue()
+	mesh := func(name string, generation int64) *v1alpha1.Mesh {
+		return &v1alpha1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: name, Generation: generation}}
+	}
+
+	// Requests for a Mesh that is already pending are coalesced, keeping the latest.
+	q.add(mesh("a", 1))
+	q.add(mesh("b", 1))
+	q.add(mesh("a", 2))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.run(ctx)
+
+	for _, expected := range []*v1alpha1.Mesh{mesh("a", 2), mesh("b", 1)} {
+		select {
+		case e := <-q.out:
+			if e.Object.GetName() != expected.Name || e.Object.GetGeneration() != expected.Generation {
+				t.Errorf("expected %s at generation %d, got %s at generation %d",
+					expected.Name, expected.Generation, e.Object.GetName(), e.Object.GetGeneration())
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a request for %s", expected.Name)
+		}
+	}
+	select {
+	case e := <-q.out:
+		t.Errorf("expected no more requests, got %s", e.Object.GetName())
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,318 @@
+package mesh_install
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/k8sapi"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The phases of a rollout of core components, in the order they are applied.
+var rolloutPhases = []string{"foundation", "redis", "control", "catalog", "edge"}
+
+// DefaultRolloutTimeout is how long to wait for the workloads of each rollout phase to become ready by default.
+const DefaultRolloutTimeout = 5 * time.Minute
+
+// RolloutCheckInterval is how often a Mesh whose rollout is in progress is requeued to check on it.
+const RolloutCheckInterval = 5 * time.Second
+
+// ErrRolloutInProgress is returned when the workloads of a rollout phase are not yet ready.
+// The caller should requeue the Mesh after RolloutCheckInterval to continue the rollout.
+var ErrRolloutInProgress = errors.New("rollout in progress")
+
+// IsRolloutInProgress reports whether an error from ApplyMesh means that its rollout is not yet complete.
+func IsRolloutInProgress(err error) bool {
+	return errors.Is(err, ErrRolloutInProgress)
+}
+
+// RolloutError is returned when a phase of a rollout fails, halting the phases after it.
+type RolloutError struct {
+	Phase string
+	Err   error
+}
+
+func (e *RolloutError) Error() string {
+	return fmt.Sprintf("rollout phase %s failed: %v", e.Phase, e.Err)
+}
+
+func (e *RolloutError) Unwrap() error {
+	return e.Err
+}
+
+// phaseOf returns the rollout phase of a core manifest: the one it is annotated with, otherwise for workloads
+// and Services the component their name refers to, otherwise "edge" for unrecognized workloads and "foundation"
+// for anything else, e.g. namespaces, RBAC, secrets, and configuration that the components depend on.
+func phaseOf(obj client.Object) (string, error) {
+	if phase, ok := obj.GetAnnotations()[wellknown.ANNOTATION_ROLLOUT_PHASE]; ok {
+		for _, p := range rolloutPhases {
+			if phase == p {
+				return phase, nil
+			}
+		}
+		return "", fmt.Errorf("invalid %s annotation %q on %s %s; must be one of %s",
+			wellknown.ANNOTATION_ROLLOUT_PHASE, phase, obj.GetObjectKind().GroupVersionKind().Kind,
+			client.ObjectKeyFromObject(obj), strings.Join(rolloutPhases, ", "))
+	}
+
+	// Prerequisites such as RBAC are named after the components that use them, so only match names of
+	// the components themselves.
+	var workload bool
+	switch obj.(type) {
+	case *appsv1.Deployment, *appsv1.StatefulSet, *appsv1.DaemonSet:
+		workload = true
+	case *corev1.Service:
+	default:
+		return "foundation", nil
+	}
+
+	name := strings.ToLower(obj.GetName())
+	switch {
+	case strings.Contains(name, "redis"), strings.Contains(name, "datastore"):
+		return "redis", nil
+	case strings.Contains(name, "catalog"):
+		return "catalog", nil
+	case strings.Contains(name, "control"):
+		return "control", nil
+	case strings.Contains(name, "edge"), strings.Contains(name, "dashboard"):
+		return "edge", nil
+	case workload:
+		return "edge", nil
+	}
+	return "foundation", nil
+}
+
+// splitPhases groups core manifests by rollout phase, keeping their order within each phase.
+func splitPhases(manifests []client.Object) ([][]client.Object, error) {
+	phases := make([][]client.Object, len(rolloutPhases))
+	for _, manifest := range manifests {
+		phase, err := phaseOf(manifest)
+		if err != nil {
+			return nil, err
+		}
+		for idx, p := range rolloutPhases {
+			if phase == p {
+				phases[idx] = append(phases[idx], manifest)
+			}
+		}
+	}
+	return phases, nil
+}
+
+// rolloutState is the progress of a Mesh's rollout, kept between reconciles so that it can be continued
+// where it left off, along with what the rest of ApplyMesh needs once it completes.
+type rolloutState struct {
+	generation  int64
+	revision    string // of the CUE the manifests were extracted from
+	names       []string
+	phases      [][]client.Object
+	status      []v1alpha1.RolloutPhase
+	current     int
+	started     time.Time // when the current phase was applied; zero if it hasn't been yet
+	operatorCUE *cuemodule.OperatorCUE
+	inventory   []v1alpha1.InventoryEntry
+	selected    map[string]bool
+	failed      error // the *RolloutError that halted the rollout, if it failed
+}
+
+// rollouts holds the rollout in progress for each Mesh, keyed by its name.
+type rollouts struct {
+	sync.Mutex
+	byName map[string]*rolloutState
+}
+
+// resume returns the rollout in progress or halted for a Mesh, if it was started for the Mesh's current generation
+// and CUE revision.
+func (r *rollouts) resume(mesh *v1alpha1.Mesh, revision string) *rolloutState {
+	r.Lock()
+	defer r.Unlock()
+	if st, ok := r.byName[mesh.Name]; ok && st.generation == mesh.Generation && st.revision == revision {
+		return st
+	}
+	return nil
+}
+
+func (r *rollouts) start(name string, st *rolloutState) {
+	r.Lock()
+	defer r.Unlock()
+	if r.byName == nil {
+		r.byName = make(map[string]*rolloutState)
+	}
+	r.byName[name] = st
+}
+
+// drop discards a Mesh's rollout in progress or halted, e.g. so that the next apply starts over with new CUE.
+func (r *rollouts) drop(name string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.byName, name)
+}
+
+// reset discards every rollout in progress or halted.
+func (r *rollouts) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.byName = nil
+}
+
+// newRollout groups a Mesh's core manifests into rollout phases and records them as pending in its status.
+func (i *Installer) newRollout(mesh *v1alpha1.Mesh, manifests []client.Object) (*rolloutState, error) {
+	phases, err := splitPhases(manifests)
+	if err != nil {
+		return nil, err
+	}
+	st := &rolloutState{generation: mesh.Generation, revision: i.Sync.Revision()}
+	for idx, phase := range phases {
+		if len(phase) > 0 {
+			st.names = append(st.names, rolloutPhases[idx])
+			st.phases = append(st.phases, phase)
+			st.status = append(st.status, v1alpha1.RolloutPhase{Name: rolloutPhases[idx], State: v1alpha1.RolloutPending})
+		}
+	}
+	i.recordRollout(mesh, st.status)
+	return st, nil
+}
+
+// rollout continues a Mesh's rollout of core manifests, applying each phase once the Deployments and
+// StatefulSets of the phase before it have rolled out. It does not wait: if the current phase is not yet
+// ready, it returns ErrRolloutInProgress so that the caller can check again later. A phase that is not ready
+// within i.RolloutTimeout fails, halting the phases after it: the rollout returns the same *RolloutError
+// until it is discarded for a new generation of the Mesh or CUE revision. Progress is reported in the Mesh's status.
+func (i *Installer) rollout(mesh *v1alpha1.Mesh, st *rolloutState) error {
+	if st.failed != nil {
+		return st.failed
+	}
+	for ; st.current < len(st.phases); st.current++ {
+		name, phase, status := st.names[st.current], st.phases[st.current], &st.status[st.current]
+
+		if st.started.IsZero() {
+			status.State = v1alpha1.RolloutProgressing
+			i.recordRollout(mesh, st.status)
+			logger.Info("Rolling out phase", "Mesh", mesh.Name, "Phase", name, "Objects", len(phase))
+			if err := i.applyPhase(mesh, phase); err != nil {
+				return i.failRollout(mesh, st, err)
+			}
+			st.started = time.Now()
+		}
+
+		if pending := i.pendingRollout(phase); len(pending) > 0 {
+			if elapsed := time.Since(st.started); elapsed > i.RolloutTimeout {
+				return i.failRollout(mesh, st, fmt.Errorf("timed out after %s waiting for %s to roll out",
+					i.RolloutTimeout, strings.Join(pending, ", ")))
+			}
+			msg := truncateMessage(fmt.Sprintf("waiting for %s to roll out", strings.Join(pending, ", ")))
+			if status.Message != msg {
+				status.Message = msg
+				i.recordRollout(mesh, st.status)
+			}
+			return fmt.Errorf("%w: phase %s is %s", ErrRolloutInProgress, name, msg)
+		}
+
+		status.State = v1alpha1.RolloutReady
+		status.Message = ""
+		i.recordRollout(mesh, st.status)
+		st.started = time.Time{}
+	}
+	return nil
+}
+
+// failRollout records the failure of a rollout's current phase and halts the rollout, so that later phases
+// are not applied until the Mesh's spec or the CUE revision changes.
+func (i *Installer) failRollout(mesh *v1alpha1.Mesh, st *rolloutState, err error) error {
+	name, status := st.names[st.current], &st.status[st.current]
+	status.State = v1alpha1.RolloutFailed
+	status.Message = truncateMessage(err.Error())
+	i.recordRollout(mesh, st.status)
+	i.recordEvent(mesh, corev1.EventTypeWarning, "RolloutFailed",
+		truncateMessage(fmt.Sprintf("Phase %s failed; later phases will not be applied until the Mesh or its CUE changes: %v", name, err)))
+	st.failed = &RolloutError{Phase: name, Err: err}
+	return st.failed
+}
+
+// applyPhase applies the core manifests of a rollout phase.
+func (i *Installer) applyPhase(mesh *v1alpha1.Mesh, manifests []client.Object) error {
+	var errs []error
+	for _, manifest := range manifests {
+		logger.Info("Applying manifest object:",
+			"Name", manifest.GetName(),
+			"Repr", manifest)
+
+		if err := k8sapi.Apply(i.K8sClient, manifest, mesh, k8sapi.MkServerSideApplyAction(i.ForceApplyConflicts)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to apply %d of %d k8s manifests: %w", len(errs), len(manifests), utilerrors.NewAggregate(errs))
+	}
+	return nil
+}
+
+// pendingRollout returns a description of each Deployment and StatefulSet among manifests that has not rolled out.
+func (i *Installer) pendingRollout(manifests []client.Object) []string {
+	var pending []string
+	for _, manifest := range manifests {
+		ready, err := i.rolledOut(manifest)
+		if err != nil {
+			logger.Error(err, "failed to check rollout", "Object", i.describe(manifest))
+		}
+		if !ready {
+			pending = append(pending, i.describe(manifest))
+		}
+	}
+	return pending
+}
+
+// rolledOut reports whether the live object of a Deployment or StatefulSet has rolled out the latest
+// revision of its spec to all of its replicas. Other objects are always considered rolled out.
+func (i *Installer) rolledOut(manifest client.Object) (bool, error) {
+	key := client.ObjectKeyFromObject(manifest)
+	switch manifest.(type) {
+	case *appsv1.Deployment:
+		d := &appsv1.Deployment{}
+		if err := (*i.K8sClient).Get(context.TODO(), key, d); err != nil {
+			return false, err
+		}
+		replicas := replicasOf(d.Spec.Replicas)
+		return d.Status.ObservedGeneration >= d.Generation &&
+			d.Status.UpdatedReplicas >= replicas &&
+			d.Status.Replicas == d.Status.UpdatedReplicas &&
+			d.Status.AvailableReplicas >= replicas, nil
+	case *appsv1.StatefulSet:
+		s := &appsv1.StatefulSet{}
+		if err := (*i.K8sClient).Get(context.TODO(), key, s); err != nil {
+			return false, err
+		}
+		replicas := replicasOf(s.Spec.Replicas)
+		updated := s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType || s.Status.UpdatedReplicas >= replicas
+		return s.Status.ObservedGeneration >= s.Generation &&
+			updated &&
+			s.Status.ReadyReplicas >= replicas, nil
+	}
+	return true, nil
+}
+
+func replicasOf(replicas *int32) int32 {
+	if replicas == nil {
+		return 1
+	}
+	return *replicas
+}
+
+// recordRollout records the progress of each rollout phase in a Mesh's status.
+func (i *Installer) recordRollout(mesh *v1alpha1.Mesh, phases []v1alpha1.RolloutPhase) {
+	rollout := append([]v1alpha1.RolloutPhase{}, phases...)
+	i.patchMeshStatus(mesh.Name, func(m *v1alpha1.Mesh) {
+		m.Status.Rollout = rollout
+	})
+}
@@ -0,0 +1,118 @@
+package mesh_install
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/wellknown"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSplitPhases(t *testing.T) {
+	meta := func(name string, annotations map[string]string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Name: name, Namespace: "greymatter", Annotations: annotations}
+	}
+	manifests := []client.Object{
+		&appsv1.Deployment{ObjectMeta: meta("edge", nil)},
+		&corev1.Service{ObjectMeta: meta("edge", nil)},
+		&appsv1.StatefulSet{ObjectMeta: meta("controlensemble", nil)},
+		&appsv1.StatefulSet{ObjectMeta: meta("greymatter-redis", nil)},
+		&appsv1.Deployment{ObjectMeta: meta("catalog", nil)},
+		&appsv1.Deployment{ObjectMeta: meta("observables", nil)},
+		&corev1.Service{ObjectMeta: meta("catalog", nil)},
+		&corev1.ServiceAccount{ObjectMeta: meta("greymatter", nil)},
+		&rbacv1.ClusterRole{ObjectMeta: meta("greymatter-control", nil)},
+		&corev1.Secret{ObjectMeta: meta("greymatter-redis-password", nil)},
+		&corev1.ConfigMap{ObjectMeta: meta("edge-config", nil)},
+		&corev1.ConfigMap{ObjectMeta: meta("catalog-seed", map[string]string{wellknown.ANNOTATION_ROLLOUT_PHASE: "catalog"})},
+	}
+
+	phases, err := splitPhases(manifests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := make(map[string][]string)
+	for idx, phase := range phases {
+		for _, obj := range phase {
+			actual[rolloutPhases[idx]] = append(actual[rolloutPhases[idx]], obj.GetName())
+		}
+	}
+	expected := map[string][]string{
+		"foundation": {"greymatter", "greymatter-control", "greymatter-redis-password", "edge-config"},
+		"redis":      {"greymatter-redis"},
+		"control":    {"controlensemble"},
+		"catalog":    {"catalog", "catalog", "catalog-seed"},
+		"edge":       {"edge", "edge", "observables"},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+
+	invalid := &corev1.Service{ObjectMeta: meta("x", map[string]string{wellknown.ANNOTATION_ROLLOUT_PHASE: "last"})}
+	if _, err := splitPhases([]client.Object{invalid}); err == nil {
+		t.Error("expected an error for an invalid rollout phase annotation")
+	}
+}
+
+func TestRollout(t *testing.T) {
+	deployment := func(name string, available int32) *appsv1.Deployment {
+		d := testDeployment(name, 2)
+		d.Status = appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: available}
+		return d
+	}
+	mesh := &v1alpha1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: "mesh"}}
+	i, _ := newTestInstaller(t, mesh, deployment("ready", 2), deployment("unavailable", 1))
+	i.RolloutTimeout = time.Minute
+
+	// A phase that has already been applied, so that only its rollout is checked.
+	started := func(manifests ...client.Object) *rolloutState {
+		return &rolloutState{
+			names:   []string{"control"},
+			phases:  [][]client.Object{manifests},
+			status:  []v1alpha1.RolloutPhase{{Name: "control", State: v1alpha1.RolloutProgressing}},
+			started: time.Now(),
+		}
+	}
+
+	if err := i.rollout(mesh, started(deployment("ready", 0))); err != nil {
+		t.Errorf("expected ready Deployment to be rolled out, got %v", err)
+	}
+
+	st := started(deployment("ready", 0), deployment("unavailable", 0))
+	err := i.rollout(mesh, st)
+	if !IsRolloutInProgress(err) || !strings.Contains(err.Error(), "Deployment greymatter/unavailable") || strings.Contains(err.Error(), "greymatter/ready") {
+		t.Errorf("expected the rollout to be in progress for only the unavailable Deployment, got %v", err)
+	}
+	if st.current != 0 || st.status[0].State != v1alpha1.RolloutProgressing {
+		t.Errorf("expected the phase to still be progressing, got %+v", st.status[0])
+	}
+
+	st.started = time.Now().Add(-2 * time.Minute)
+	err = i.rollout(mesh, st)
+	var rolloutErr *RolloutError
+	if !errors.As(err, &rolloutErr) || rolloutErr.Phase != "control" || !strings.Contains(err.Error(), "timed out after 1m0s") {
+		t.Errorf("expected the control phase to time out, got %v", err)
+	}
+	if st.status[0].State != v1alpha1.RolloutFailed {
+		t.Errorf("expected the phase to have failed, got %+v", st.status[0])
+	}
+
+	// The failed rollout stays halted for the same generation and revision, without checking on the phase again.
+	var r rollouts
+	r.start("mesh", st)
+	if resumed := r.resume(mesh, ""); resumed != st || resumed.failed == nil || i.rollout(mesh, resumed) != st.failed {
+		t.Errorf("expected the rollout to stay halted, got %+v", resumed)
+	}
+	if r.resume(mesh, "abc") != nil {
+		t.Error("expected a new CUE revision to start a new rollout")
+	}
+}
@@ -0,0 +1,194 @@
+package mesh_install
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/k8sapi"
+	"github.com/greymatter-io/operator/pkg/sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// The conditions that must all be true for a Mesh to be considered ready.
+var readinessConditions = []string{
+	v1alpha1.ConditionManifestsApplied,
+	v1alpha1.ConditionControlReachable,
+	v1alpha1.ConditionCatalogReachable,
+	v1alpha1.ConditionCoreConfigApplied,
+}
+
+// reportCondition implements gmapi.ConditionReporter by recording a condition in the named Mesh's status.
+func (i *Installer) reportCondition(meshName string, condition metav1.Condition) {
+	i.patchMeshStatus(meshName, func(mesh *v1alpha1.Mesh) {
+		setCondition(mesh, condition)
+	})
+}
+
+// recordApplyResult records the outcome of applying a Mesh's core manifests in its status,
+// along with the generation and CUE revision (and the ref it was resolved from) if they were applied.
+func (i *Installer) recordApplyResult(mesh *v1alpha1.Mesh, err error) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionManifestsApplied,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Applied",
+		Message:            "Core component manifests have been applied",
+		ObservedGeneration: mesh.Generation,
+	}
+	if i.DryRun && err == nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "DryRun"
+		condition.Message = "Changes have been planned but not applied; see the Planned Event"
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ApplyFailed"
+		condition.Message = truncateMessage(err.Error())
+		var cueErr *cuemodule.Error
+		if errors.As(err, &cueErr) {
+			condition.Reason = "CUEError"
+			i.recordEvent(mesh, corev1.EventTypeWarning, "CUEError", condition.Message)
+		}
+		var rolloutErr *RolloutError
+		if errors.As(err, &rolloutErr) {
+			condition.Reason = "RolloutFailed"
+		}
+		if errors.Is(err, ErrRolloutInProgress) {
+			condition.Reason = "RollingOut"
+		}
+	}
+
+	i.patchMeshStatus(mesh.Name, func(m *v1alpha1.Mesh) {
+		// Failures and rollouts in progress are only reported by the condition, so that the observed generation
+		// is one that took effect. A dry run only reports that it planned; nothing was applied from the revision.
+		if err == nil && !i.DryRun {
+			m.Status.ObservedGeneration = mesh.Generation
+			m.Status.CUERevision = i.Sync.Revision()
+			m.Status.CUERef = i.Sync.Ref()
+		}
+		setCondition(m, condition)
+	})
+}
+
+// recordRevisionResult records whether the latest revision synchronized from the GitOps repository
+// passed signature verification and validation, and which revision remains active if it did not, in each applied Mesh.
+func (i *Installer) recordRevisionResult(rev sync.Revision, err error) {
+	condition := metav1.Condition{
+		Type:    v1alpha1.ConditionRevisionValid,
+		Status:  metav1.ConditionTrue,
+		Reason:  "Validated",
+		Message: fmt.Sprintf("Revision %s is active", rev),
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ValidationFailed"
+		if errors.Is(err, sync.ErrUntrustedRevision) {
+			condition.Reason = "SignatureVerificationFailed"
+		}
+		condition.Message = truncateMessage(fmt.Sprintf("Revision %s was not activated; keeping revision %s: %v",
+			rev, i.Sync.Revision(), err))
+	}
+
+	for _, mesh := range i.AppliedMeshes() {
+		if err != nil {
+			i.recordEvent(mesh, corev1.EventTypeWarning, condition.Reason, condition.Message)
+		}
+		i.patchMeshStatus(mesh.Name, func(m *v1alpha1.Mesh) {
+			setCondition(m, condition)
+		})
+	}
+}
+
+// recordEvent records an Event on a Mesh, if the Installer has a Recorder.
+func (i *Installer) recordEvent(mesh *v1alpha1.Mesh, eventType, reason, message string) {
+	if i.Recorder != nil {
+		i.Recorder.Event(mesh, eventType, reason, message)
+	}
+}
+
+// The maximum length of a condition message accepted by the apiserver.
+const maxConditionMessage = 32768
+
+// truncateMessage shortens a message to fit in a condition, e.g. a CUE error listing many errors.
+func truncateMessage(msg string) string {
+	const suffix = "... (truncated)"
+	if len(msg) <= maxConditionMessage {
+		return msg
+	}
+	// Cut on a rune boundary, since the apiserver rejects a message that isn't valid UTF-8.
+	cut := maxConditionMessage - len(suffix)
+	for cut > 0 && !utf8.RuneStart(msg[cut]) {
+		cut--
+	}
+	return msg[:cut] + suffix
+}
+
+// patchMeshStatus applies an update to the status of the named Mesh.
+// Failures are logged by k8sapi.Apply and otherwise ignored, since status is informational.
+func (i *Installer) patchMeshStatus(name string, update func(*v1alpha1.Mesh)) {
+	mesh := &v1alpha1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	k8sapi.Apply(i.K8sClient, mesh, nil, k8sapi.MkStatusPatchAction(func(obj client.Object) client.Object {
+		m := obj.(*v1alpha1.Mesh)
+		update(m)
+		return m
+	}))
+}
+
+// setCondition sets a condition in a Mesh's status and recomputes its Ready condition.
+func setCondition(mesh *v1alpha1.Mesh, condition metav1.Condition) {
+	if condition.ObservedGeneration == 0 {
+		condition.ObservedGeneration = mesh.Generation
+	}
+	meta.SetStatusCondition(&mesh.Status.Conditions, condition)
+
+	ready := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            "Core components are installed and configured",
+		ObservedGeneration: mesh.Generation,
+	}
+	for _, t := range readinessConditions {
+		c := meta.FindStatusCondition(mesh.Status.Conditions, t)
+		if c == nil {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = "Pending"
+			ready.Message = fmt.Sprintf("Waiting for %s", t)
+			break
+		}
+		if c.Status != metav1.ConditionTrue {
+			ready.Status = metav1.ConditionFalse
+			ready.Reason = c.Reason
+			ready.Message = fmt.Sprintf("%s: %s", t, c.Message)
+			break
+		}
+	}
+	meta.SetStatusCondition(&mesh.Status.Conditions, ready)
+}
+
+// RecordTeardownResult records the objects that could not be removed while tearing down a Mesh in its status.
+func (i *Installer) RecordTeardownResult(mesh *v1alpha1.Mesh, leftovers []string) {
+	condition := metav1.Condition{
+		Type:               v1alpha1.ConditionTeardownComplete,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Removed",
+		Message:            "Core components and mesh configuration have been removed",
+		ObservedGeneration: mesh.Generation,
+	}
+	if len(leftovers) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "LeftoversRemain"
+		condition.Message = fmt.Sprintf("%d objects could not be removed; see status.leftovers", len(leftovers))
+	}
+
+	i.patchMeshStatus(mesh.Name, func(m *v1alpha1.Mesh) {
+		m.Status.Leftovers = leftovers
+		meta.SetStatusCondition(&m.Status.Conditions, condition)
+	})
+}
@@ -0,0 +1,88 @@
+package mesh_install
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestSetConditionComputesReady(t *testing.T) {
+	mesh := &v1alpha1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: "mesh", Generation: 3}}
+
+	setCondition(mesh, metav1.Condition{Type: v1alpha1.ConditionManifestsApplied, Status: metav1.ConditionTrue, Reason: "Applied"})
+	ready := meta.FindStatusCondition(mesh.Status.Conditions, v1alpha1.ConditionReady)
+	if ready == nil || ready.Status != metav1.ConditionFalse || ready.Reason != "Pending" {
+		t.Fatalf("expected Ready to be pending, got %+v", ready)
+	}
+	if ready.ObservedGeneration != 3 {
+		t.Errorf("expected observed generation 3, got %d", ready.ObservedGeneration)
+	}
+
+	setCondition(mesh, metav1.Condition{Type: v1alpha1.ConditionControlReachable, Status: metav1.ConditionFalse, Reason: "Connecting", Message: "connection refused"})
+	ready = meta.FindStatusCondition(mesh.Status.Conditions, v1alpha1.ConditionReady)
+	if ready.Status != metav1.ConditionFalse || ready.Reason != "Connecting" {
+		t.Fatalf("expected Ready to reflect ControlReachable, got %+v", ready)
+	}
+
+	for _, c := range []string{
+		v1alpha1.ConditionControlReachable,
+		v1alpha1.ConditionCatalogReachable,
+		v1alpha1.ConditionCoreConfigApplied,
+	} {
+		setCondition(mesh, metav1.Condition{Type: c, Status: metav1.ConditionTrue, Reason: "OK"})
+	}
+	if !meta.IsStatusConditionTrue(mesh.Status.Conditions, v1alpha1.ConditionReady) {
+		t.Fatalf("expected Ready to be true, got %+v", mesh.Status.Conditions)
+	}
+}
+
+func TestRecordApplyResult(t *testing.T) {
+	mesh := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh", Generation: 3},
+		Status:     v1alpha1.MeshStatus{ObservedGeneration: 2, CUERevision: "abc"},
+	}
+	i, c := newTestInstaller(t, mesh)
+
+	// A failed apply leaves generation 2 in effect.
+	i.recordApplyResult(mesh, errors.New("failed to apply"))
+	updated := &v1alpha1.Mesh{}
+	if err := c.Get(context.TODO(), client.ObjectKey{Name: "mesh"}, updated); err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status.ObservedGeneration != 2 || updated.Status.CUERevision != "abc" {
+		t.Errorf("expected generation 2 and revision abc to remain in effect, got %d and %q",
+			updated.Status.ObservedGeneration, updated.Status.CUERevision)
+	}
+	applied := meta.FindStatusCondition(updated.Status.Conditions, v1alpha1.ConditionManifestsApplied)
+	if applied == nil || applied.Reason != "ApplyFailed" || applied.ObservedGeneration != 3 {
+		t.Errorf("expected ManifestsApplied to report the failure to apply generation 3, got %+v", applied)
+	}
+}
+
+func TestTruncateMessage(t *testing.T) {
+	if msg := truncateMessage("short"); msg != "short" {
+		t.Errorf("expected a short message to be unchanged, got %q", msg)
+	}
+
+	// Each "é" is two bytes, so an odd cut would split one.
+	for _, prefix := range []string{"", "x"} {
+		msg := truncateMessage(prefix + strings.Repeat("é", maxConditionMessage))
+		if len(msg) > maxConditionMessage {
+			t.Errorf("expected at most %d bytes, got %d", maxConditionMessage, len(msg))
+		}
+		if !utf8.ValidString(msg) {
+			t.Errorf("expected valid UTF-8 with prefix %q", prefix)
+		}
+		if !strings.HasSuffix(msg, "... (truncated)") {
+			t.Errorf("expected a truncation suffix with prefix %q", prefix)
+		}
+	}
+}
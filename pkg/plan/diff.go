@@ -0,0 +1,115 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// Keys that can be written as .key in a field path; others are written as ["key"].
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Diff compares the fields set in a desired object with a live one, both in their generic JSON representation.
+// Fields that are only set in the live object, e.g. defaults and values set by the server, are ignored,
+// as are null or empty desired values for fields the live object does not set.
+// Numbers are compared by value, so that e.g. a desired float64 2 equals a live int64 2.
+func Diff(desired, live map[string]interface{}) []FieldChange {
+	var changes []FieldChange
+	diffValue("", desired, live, &changes)
+	return changes
+}
+
+func diffValue(path string, desired, live interface{}, changes *[]FieldChange) {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		l, ok := live.(map[string]interface{})
+		if !ok {
+			*changes = append(*changes, FieldChange{Path: path, Live: live, Desired: desired})
+			return
+		}
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			lv, ok := l[k]
+			if !ok && isEmpty(d[k]) {
+				continue
+			}
+			diffValue(fieldPath(path, k), d[k], lv, changes)
+		}
+	case []interface{}:
+		l, ok := live.([]interface{})
+		if !ok || len(l) != len(d) {
+			if !ok && len(d) == 0 {
+				return
+			}
+			*changes = append(*changes, FieldChange{Path: path, Live: live, Desired: desired})
+			return
+		}
+		for i := range d {
+			diffValue(fmt.Sprintf("%s[%d]", path, i), d[i], l[i], changes)
+		}
+	case nil:
+		// Unset desired fields are left to the server.
+	default:
+		if !reflect.DeepEqual(desired, live) && !equalNumbers(desired, live) {
+			*changes = append(*changes, FieldChange{Path: path, Live: live, Desired: desired})
+		}
+	}
+}
+
+// equalNumbers reports whether two values are equal numbers, regardless of their types.
+// Objects decoded with encoding/json have float64 numbers, whereas unstructured objects have int64 ones.
+func equalNumbers(a, b interface{}) bool {
+	x, ok := number(a)
+	if !ok {
+		return false
+	}
+	y, ok := number(b)
+	return ok && x == y
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func isEmpty(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return true
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func fieldPath(path, key string) string {
+	if !identifier.MatchString(key) {
+		return fmt.Sprintf("%s[%q]", path, key)
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
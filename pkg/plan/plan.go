@@ -0,0 +1,281 @@
+// Package plan previews the changes that applying a Mesh with the operator CUE would make to the
+// Kubernetes objects of its core components and the objects configured in its Control and Catalog APIs.
+package plan
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/gmapi"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// Targets of a planned change.
+const (
+	TargetK8s = "k8s"
+	TargetGM  = "gm"
+)
+
+// Action is what applying the Mesh would do to an object.
+type Action string
+
+const (
+	Create   Action = "create"
+	Update   Action = "update"
+	Delete   Action = "delete"
+	NoChange Action = "no-change"
+)
+
+// Plan lists the changes that applying a Mesh would make.
+type Plan struct {
+	Mesh    string       `json:"mesh"`
+	Objects []ObjectPlan `json:"objects"`
+	// Why Control and Catalog objects were not compared, if they were not.
+	GMSkipped string `json:"gm_skipped,omitempty"`
+}
+
+// ObjectPlan is the change that applying a Mesh would make to a single object.
+type ObjectPlan struct {
+	// TargetK8s or TargetGM.
+	Target     string `json:"target"`
+	APIVersion string `json:"api_version,omitempty"`
+	// A k8s kind, or a Control or Catalog kind such as cluster or catalogservice.
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	// A k8s object's name, or a Control or Catalog object's key.
+	Name   string `json:"name"`
+	Action Action `json:"action"`
+	// For updates, each field whose live value differs from the desired value.
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Set if the live object could not be retrieved.
+	Error string `json:"error,omitempty"`
+}
+
+// FieldChange is a field whose live value differs from the desired value.
+type FieldChange struct {
+	// e.g. spec.template.spec.containers[0].image
+	Path    string      `json:"path"`
+	Live    interface{} `json:"live"`
+	Desired interface{} `json:"desired"`
+}
+
+func (o ObjectPlan) String() string {
+	if o.Namespace != "" {
+		return fmt.Sprintf("%s %s %s/%s", o.Target, o.Kind, o.Namespace, o.Name)
+	}
+	return fmt.Sprintf("%s %s %s", o.Target, o.Kind, o.Name)
+}
+
+// Make plans the changes to apply a Mesh, comparing the manifests and mesh configs extracted from
+// operatorCUE, which must already be unified with the Mesh, with the live objects they describe.
+// Objects in the Mesh's inventories that are no longer extracted are planned for deletion.
+// If api is nil, Control and Catalog objects are not compared.
+func Make(ctx context.Context, c client.Client, api *gmhttp.Client, operatorCUE *cuemodule.OperatorCUE, mesh *v1alpha1.Mesh) (*Plan, error) {
+	p := &Plan{Mesh: mesh.Name}
+
+	manifests, err := operatorCUE.ExtractCoreK8sManifests()
+	if err != nil {
+		return nil, err
+	}
+	desiredK8s := make(map[v1alpha1.InventoryEntry]bool)
+	for _, manifest := range manifests {
+		gvk, err := apiutil.GVKForObject(manifest, c.Scheme())
+		if err != nil {
+			return nil, err
+		}
+		apiVersion, kind := gvk.ToAPIVersionAndKind()
+		entry := v1alpha1.InventoryEntry{APIVersion: apiVersion, Kind: kind, Namespace: manifest.GetNamespace(), Name: manifest.GetName()}
+		desiredK8s[entry] = true
+
+		desired, err := toMap(manifest)
+		if err != nil {
+			return nil, err
+		}
+		p.Objects = append(p.Objects, planK8s(ctx, c, entry, desired))
+	}
+	for _, entry := range mesh.Status.Inventory {
+		if !desiredK8s[entry] {
+			p.Objects = append(p.Objects, planK8s(ctx, c, entry, nil))
+		}
+	}
+
+	if api == nil {
+		p.GMSkipped = "no Control and Catalog API client"
+		return p, nil
+	}
+	meshConfigs, kinds, err := operatorCUE.ExtractCoreMeshConfigs()
+	if err != nil {
+		return nil, err
+	}
+	entries := gmapi.ConfigInventory(meshConfigs, kinds)
+	desiredGM := make(map[v1alpha1.ConfigInventoryEntry]bool)
+	idx := 0
+	for i, kind := range kinds {
+		if kind == "" {
+			continue
+		}
+		entry := entries[idx]
+		idx++
+		desiredGM[entry] = true
+
+		var desired map[string]interface{}
+		if err := json.Unmarshal(meshConfigs[i], &desired); err != nil {
+			return nil, fmt.Errorf("invalid mesh config %s %s: %w", entry.Kind, entry.Key, err)
+		}
+		p.Objects = append(p.Objects, planGM(ctx, api, entry, desired))
+	}
+	for _, entry := range mesh.Status.ConfigInventory {
+		if !desiredGM[entry] {
+			p.Objects = append(p.Objects, planGM(ctx, api, entry, nil))
+		}
+	}
+
+	return p, nil
+}
+
+// planK8s compares a desired k8s object with the live one. If desired is nil, the object is planned for deletion.
+func planK8s(ctx context.Context, c client.Client, entry v1alpha1.InventoryEntry, desired map[string]interface{}) ObjectPlan {
+	o := ObjectPlan{Target: TargetK8s, APIVersion: entry.APIVersion, Kind: entry.Kind, Namespace: entry.Namespace, Name: entry.Name}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(schema.FromAPIVersionAndKind(entry.APIVersion, entry.Kind))
+	err := c.Get(ctx, client.ObjectKey{Namespace: entry.Namespace, Name: entry.Name}, live)
+	switch {
+	case errors.IsNotFound(err) && desired == nil:
+		o.Action = NoChange
+	case errors.IsNotFound(err):
+		o.Action = Create
+	case err != nil:
+		o.Action = Update
+		o.Error = err.Error()
+	case desired == nil:
+		o.Action = Delete
+	default:
+		delete(desired, "status")
+		o.Changes = Diff(desired, live.Object)
+		o.Action = actionFor(o.Changes)
+	}
+	return o
+}
+
+// planGM compares a desired Control or Catalog object with the live one. If desired is nil, the object is planned for deletion.
+func planGM(ctx context.Context, api *gmhttp.Client, entry v1alpha1.ConfigInventoryEntry, desired map[string]interface{}) ObjectPlan {
+	o := ObjectPlan{Target: TargetGM, Kind: entry.Kind, Name: entry.Key}
+
+	data, err := gmapi.GetObject(ctx, api, entry)
+	switch {
+	case gmhttp.IsNotFound(err) && desired == nil:
+		o.Action = NoChange
+	case gmhttp.IsNotFound(err):
+		o.Action = Create
+	case err != nil:
+		o.Action = Update
+		o.Error = err.Error()
+	case desired == nil:
+		o.Action = Delete
+	default:
+		var live map[string]interface{}
+		if err := json.Unmarshal(data, &live); err != nil {
+			o.Action = Update
+			o.Error = fmt.Sprintf("invalid response: %v", err)
+			break
+		}
+		o.Changes = Diff(desired, live)
+		o.Action = actionFor(o.Changes)
+	}
+	return o
+}
+
+func actionFor(changes []FieldChange) Action {
+	if len(changes) == 0 {
+		return NoChange
+	}
+	return Update
+}
+
+// toMap converts an object to its generic JSON representation.
+func toMap(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// HasChanges reports whether applying the Mesh would change any object.
+func (p *Plan) HasChanges() bool {
+	for _, o := range p.Objects {
+		if o.Action != NoChange {
+			return true
+		}
+	}
+	return false
+}
+
+// Summary counts the planned changes, e.g. "1 to create, 2 to update, 0 to delete".
+func (p *Plan) Summary() string {
+	counts := make(map[Action]int)
+	for _, o := range p.Objects {
+		counts[o.Action]++
+	}
+	return fmt.Sprintf("%d to create, %d to update, %d to delete", counts[Create], counts[Update], counts[Delete])
+}
+
+// WriteText writes a human-readable plan, listing each object that would change and how.
+func (p *Plan) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Plan for Mesh %s:\n", p.Mesh)
+	for _, o := range p.Objects {
+		switch o.Action {
+		case Create:
+			fmt.Fprintf(&b, "+ %s\n", o)
+		case Delete:
+			fmt.Fprintf(&b, "- %s\n", o)
+		case Update:
+			fmt.Fprintf(&b, "~ %s\n", o)
+			if o.Error != "" {
+				fmt.Fprintf(&b, "    (could not be compared: %s)\n", o.Error)
+			}
+			for _, c := range o.Changes {
+				fmt.Fprintf(&b, "    %s: %s => %s\n", c.Path, formatValue(c.Live), formatValue(c.Desired))
+			}
+		}
+	}
+	if p.GMSkipped != "" {
+		fmt.Fprintf(&b, "Control and Catalog objects were not compared: %s\n", p.GMSkipped)
+	}
+	fmt.Fprintf(&b, "%s.\n", p.Summary())
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the plan as JSON, e.g. for CI.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "(none)"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
@@ -0,0 +1,155 @@
+package plan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/greymatter-io/operator/api/v1alpha1"
+	"github.com/greymatter-io/operator/pkg/cuemodule"
+	"github.com/greymatter-io/operator/pkg/gmhttp"
+
+	"cuelang.org/go/cue/cuecontext"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestDiff(t *testing.T) {
+	var desired, live map[string]interface{}
+	json.Unmarshal([]byte(`{
+		"metadata": {"name": "control", "creationTimestamp": null, "annotations": {"greymatter.io/a": "b"}},
+		"spec": {"replicas": 2, "containers": [{"image": "control:1.8"}], "empty": {}}
+	}`), &desired)
+	json.Unmarshal([]byte(`{
+		"metadata": {"name": "control", "creationTimestamp": "2022-01-01T00:00:00Z", "resourceVersion": "1"},
+		"spec": {"replicas": 1, "containers": [{"image": "control:1.7", "imagePullPolicy": "Always"}]},
+		"status": {"ready": true}
+	}`), &live)
+
+	expected := []FieldChange{
+		{Path: `metadata.annotations`, Live: nil, Desired: map[string]interface{}{"greymatter.io/a": "b"}},
+		{Path: `spec.containers[0].image`, Live: "control:1.7", Desired: "control:1.8"},
+		{Path: `spec.replicas`, Live: float64(1), Desired: float64(2)},
+	}
+	if actual := Diff(desired, live); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+
+	// Live objects from the unstructured client have int64 numbers.
+	desired = map[string]interface{}{"spec": map[string]interface{}{
+		"replicas": float64(2),
+		"ports":    []interface{}{map[string]interface{}{"port": float64(8080)}},
+	}}
+	live = map[string]interface{}{"spec": map[string]interface{}{
+		"replicas": int64(2),
+		"ports":    []interface{}{map[string]interface{}{"port": int64(8443)}},
+	}}
+	expected = []FieldChange{{Path: `spec.ports[0].port`, Live: int64(8443), Desired: float64(8080)}}
+	if actual := Diff(desired, live); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, got %+v", expected, actual)
+	}
+}
+
+func TestMake(t *testing.T) {
+	scheme := runtime.NewScheme()
+	clientgoscheme.AddToScheme(scheme)
+	v1alpha1.AddToScheme(scheme)
+
+	ctx := cuecontext.New()
+	operatorCUE := &cuemodule.OperatorCUE{
+		K8s: ctx.CompileString(`k8s_manifests: [
+			{apiVersion: "v1", kind: "ConfigMap", metadata: {name: "same", namespace: "greymatter"}, data: a: "1"},
+			{apiVersion: "v1", kind: "ConfigMap", metadata: {name: "changed", namespace: "greymatter"}, data: a: "2"},
+			{apiVersion: "v1", kind: "ConfigMap", metadata: {name: "new", namespace: "greymatter"}},
+			{apiVersion: "v1", kind: "Service", metadata: {name: "same", namespace: "greymatter"}, spec: ports: [{name: "proxy", port: 10808}]},
+			{apiVersion: "apps/v1", kind: "Deployment", metadata: {name: "same", namespace: "greymatter"}, spec: replicas: 2},
+			{apiVersion: "apps/v1", kind: "Deployment", metadata: {name: "scaled", namespace: "greymatter"}, spec: replicas: 3},
+		]`),
+		GM: ctx.CompileString(`mesh_configs: [
+			{cluster_key: "edge", zone_key: "default-zone", require_tls: true},
+			{route_key: "new", zone_key: "default-zone"},
+		]`),
+	}
+	configMap := func(name, value string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "greymatter"}, Data: map[string]string{"a": value}}
+	}
+	deployment := func(name string, replicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "greymatter"}, Spec: appsv1.DeploymentSpec{Replicas: &replicas}}
+	}
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "same", Namespace: "greymatter"},
+		Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "proxy", Port: 10808}}},
+	}
+	mesh := &v1alpha1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh"},
+		Status: v1alpha1.MeshStatus{
+			Inventory: []v1alpha1.InventoryEntry{
+				{APIVersion: "v1", Kind: "ConfigMap", Namespace: "greymatter", Name: "removed"},
+			},
+			ConfigInventory: []v1alpha1.ConfigInventoryEntry{{Kind: "listener", Key: "old"}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		configMap("same", "1"), configMap("changed", "1"), configMap("removed", "1"),
+		deployment("same", 2), deployment("scaled", 2), service,
+	).Build()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.0/cluster/edge":
+			w.Write([]byte(`{"cluster_key": "edge", "zone_key": "default-zone", "require_tls": false, "checksum": "abc"}`))
+		case "/v1.0/listener/old":
+			w.Write([]byte(`{"listener_key": "old"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	p, err := Make(context.Background(), c, gmhttp.New(server.URL, server.URL, nil), operatorCUE, mesh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(map[string]Action)
+	for _, o := range p.Objects {
+		actions[o.String()] = o.Action
+	}
+	expected := map[string]Action{
+		"k8s ConfigMap greymatter/same":    NoChange,
+		"k8s ConfigMap greymatter/changed": Update,
+		"k8s ConfigMap greymatter/new":     Create,
+		"k8s ConfigMap greymatter/removed": Delete,
+		"k8s Service greymatter/same":      NoChange,
+		"k8s Deployment greymatter/same":   NoChange,
+		"k8s Deployment greymatter/scaled": Update,
+		"gm cluster edge":                  Update,
+		"gm route new":                     Create,
+		"gm listener old":                  Delete,
+	}
+	if !reflect.DeepEqual(actions, expected) {
+		t.Errorf("expected %v, got %v", expected, actions)
+	}
+
+	var b bytes.Buffer
+	p.WriteText(&b)
+	for _, line := range []string{
+		"~ k8s ConfigMap greymatter/changed\n    data.a: \"1\" => \"2\"",
+		"~ gm cluster edge\n    require_tls: false => true",
+		"~ k8s Deployment greymatter/scaled\n    spec.replicas: 2 => 3",
+		"2 to create, 3 to update, 2 to delete.",
+	} {
+		if !strings.Contains(b.String(), line) {
+			t.Errorf("expected plan to contain %q, got:\n%s", line, b.String())
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+)
+
+// activate makes a revision checked out in the staging directory (GitDir) the one loaded by the operator.
+// The revision is copied into its own directory and validated there; only if it is valid is ActiveDir
+// atomically re-pointed at it, so that a failing revision leaves the last-known-good revision active.
+// If ActiveDir is not set, the staging directory is validated in place.
+// Revisions that are not signed by a trusted key, if signatures are required, are never activated.
+func (s *Sync) activate(rev Revision) error {
+	if s.verifies() {
+		repo, err := git.PlainOpen(s.GitDir)
+		if err != nil {
+			return fmt.Errorf("unable to open local repository %s: %w", s.GitDir, err)
+		}
+		if err := s.verify(repo, rev); err != nil {
+			return err
+		}
+	}
+
+	if s.ActiveDir == "" {
+		return s.validate(s.GitDir)
+	}
+
+	revisionsDir := s.ActiveDir + ".revisions"
+	dir, err := filepath.Abs(filepath.Join(revisionsDir, rev.SHA))
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := copyTree(s.GitDir, dir); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("failed to stage revision %s: %w", rev, err)
+	}
+	if err := s.validate(dir); err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	previous, _ := os.Readlink(s.ActiveDir)
+
+	// Point a temporary symlink at the new revision, then rename it over ActiveDir,
+	// which atomically replaces the previous symlink.
+	tmp := s.ActiveDir + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(dir, tmp); err != nil {
+		return fmt.Errorf("failed to activate revision %s: %w", rev, err)
+	}
+	if info, err := os.Lstat(s.ActiveDir); err == nil && info.Mode()&os.ModeSymlink == 0 {
+		// Replace a directory left by an earlier operator version.
+		if err := os.RemoveAll(s.ActiveDir); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, s.ActiveDir); err != nil {
+		return fmt.Errorf("failed to activate revision %s: %w", rev, err)
+	}
+
+	// Keep only the active revision and the one it replaced.
+	entries, _ := os.ReadDir(revisionsDir)
+	for _, e := range entries {
+		p := filepath.Join(revisionsDir, e.Name())
+		if abs, _ := filepath.Abs(p); abs != dir && abs != previous {
+			os.RemoveAll(p)
+		}
+	}
+
+	return nil
+}
+
+func (s *Sync) validate(dir string) error {
+	if s.Validate == nil {
+		return nil
+	}
+	if err := s.Validate(dir); err != nil {
+		return fmt.Errorf("validation failed: %w", err)
+	}
+	return nil
+}
+
+// copyTree copies the files in src to dst, excluding git metadata.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil // submodules have a .git file
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0o700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestActivate(t *testing.T) {
+	root := t.TempDir()
+	s := &Sync{
+		GitDir:    filepath.Join(root, "staging"),
+		ActiveDir: filepath.Join(root, "active"),
+	}
+	checkout := func(contents string) {
+		if err := os.MkdirAll(filepath.Join(s.GitDir, ".git"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(s.GitDir, "mesh.cue"), []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	active := func() string {
+		b, err := os.ReadFile(filepath.Join(s.ActiveDir, "mesh.cue"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+
+	checkout("a")
+	if err := s.activate(Revision{SHA: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := active(); got != "a" {
+		t.Errorf("expected revision a to be active, got %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(s.ActiveDir, ".git")); !os.IsNotExist(err) {
+		t.Error("expected git metadata not to be copied")
+	}
+
+	// An invalid revision leaves the last-known-good revision active.
+	s.Validate = func(dir string) error {
+		b, _ := os.ReadFile(filepath.Join(dir, "mesh.cue"))
+		if string(b) == "bad" {
+			return errors.New("invalid")
+		}
+		return nil
+	}
+	checkout("bad")
+	if err := s.activate(Revision{SHA: "bad"}); err == nil {
+		t.Error("expected an error activating an invalid revision")
+	}
+	if got := active(); got != "a" {
+		t.Errorf("expected revision a to remain active, got %s", got)
+	}
+
+	checkout("b")
+	if err := s.activate(Revision{SHA: "b"}); err != nil {
+		t.Fatal(err)
+	}
+	checkout("c")
+	if err := s.activate(Revision{SHA: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := active(); got != "c" {
+		t.Errorf("expected revision c to be active, got %s", got)
+	}
+
+	// Only the active and previous revisions are kept.
+	entries, err := os.ReadDir(s.ActiveDir + ".revisions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+	if len(kept) != 2 || kept[0] != "b" || kept[1] != "c" {
+		t.Errorf("expected revisions [b c] to be kept, got %v", kept)
+	}
+}
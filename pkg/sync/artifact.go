@@ -0,0 +1,274 @@
+package sync
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// The most bytes of files that are extracted from an OCI artifact or tarball, across all of its layers.
+const maxExtractedBytes int64 = 256 << 20
+
+// artifact reports whether the Sync pulls its CUE from an OCI artifact or tarball instead of Git.
+func (s *Sync) artifact() bool {
+	return s.OCIArtifact != "" || s.TarballURL != ""
+}
+
+// pullArtifact checks the OCI artifact or tarball for a new digest and, if it has changed since the last
+// synchronized or failed revision, downloads and extracts it into GitDir, or a temporary directory if GitDir is not set.
+// GitDir is removed if the artifact cannot be fetched, so that nothing unverified is left in it.
+func (s *Sync) pullArtifact() (Revision, error) {
+	var rev Revision
+	var err error
+	if s.OCIArtifact != "" {
+		rev, err = s.latestOCI()
+	} else {
+		rev, err = s.latestTarball()
+	}
+	if err != nil {
+		return Revision{}, err
+	}
+	if rev.SHA == s.Revision() || rev == s.lastFailed() {
+		return rev, nil
+	}
+
+	if s.GitDir == "" {
+		if s.GitDir, err = os.MkdirTemp("", "gm-operator-cue-"); err != nil {
+			return Revision{}, err
+		}
+	} else if err := os.RemoveAll(s.GitDir); err != nil {
+		return Revision{}, err
+	}
+	if err := os.MkdirAll(s.GitDir, 0o755); err != nil {
+		return Revision{}, err
+	}
+
+	limit := maxExtractedBytes
+	if s.OCIArtifact != "" {
+		err = s.fetchOCI(rev, &limit)
+	} else {
+		err = s.fetchTarball(rev, &limit)
+	}
+	if err != nil {
+		if rmErr := os.RemoveAll(s.GitDir); rmErr != nil {
+			logger.Error(rmErr, "failed to remove unverified artifact", "Dir", s.GitDir)
+		}
+		return Revision{}, fmt.Errorf("failed to fetch %s: %w", s.Remote, err)
+	}
+	return rev, nil
+}
+
+// latestTarball returns the digest of the tarball, which is either pinned or read from a sha256sum file at <url>.sha256.
+func (s *Sync) latestTarball() (Revision, error) {
+	if s.TarballSHA256 != "" {
+		return Revision{SHA: "sha256:" + strings.TrimPrefix(s.TarballSHA256, "sha256:")}, nil
+	}
+
+	resp, err := s.httpGet(s.TarballURL+".sha256", nil)
+	if err != nil {
+		return Revision{}, err
+	}
+	defer resp.Body.Close()
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, 1024)).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return Revision{}, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return Revision{}, fmt.Errorf("empty checksum at %s.sha256", s.TarballURL)
+	}
+	if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != sha256.Size*2 {
+		return Revision{}, fmt.Errorf("invalid checksum at %s.sha256", s.TarballURL)
+	}
+	return Revision{SHA: "sha256:" + fields[0]}, nil
+}
+
+// fetchTarball downloads the tarball, verifies its checksum, and extracts up to limit bytes of it into GitDir.
+func (s *Sync) fetchTarball(rev Revision, limit *int64) error {
+	resp, err := s.httpGet(s.TarballURL, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return extractVerified(resp.Body, rev.SHA, s.GitDir, limit)
+}
+
+// extractVerified extracts a tar or gzipped tar into dir, returning an error if its digest does not match.
+// Since the digest is only known once the stream has been read, dir should be discarded on error.
+// The bytes of files extracted are deducted from limit, and extraction fails if they would exceed it.
+func extractVerified(r io.Reader, digest, dir string, limit *int64) error {
+	h := sha256.New()
+	if err := extractTar(io.TeeReader(r, h), dir, limit); err != nil {
+		return err
+	}
+	// Drain any trailing padding so that it is included in the digest.
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	if actual := "sha256:" + hex.EncodeToString(h.Sum(nil)); actual != digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// extractTar extracts the directories and regular files of a tar or gzipped tar into dir,
+// deducting the bytes of files extracted from limit and failing if they would exceed it.
+func extractTar(r io.Reader, dir string, limit *int64) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dir, hdr.Name)
+		if target != filepath.Clean(dir) && !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path %q in archive", hdr.Name)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(f, io.LimitReader(tr, *limit+1))
+			if err != nil {
+				f.Close()
+				return err
+			}
+			if *limit -= n; *limit < 0 {
+				f.Close()
+				return fmt.Errorf("archive is larger than %d bytes", maxExtractedBytes)
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Read to the end of a gzip stream so that it is fully digested.
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// httpClient returns a client for artifact sources that trusts the configured CA bundle.
+func (s *Sync) httpClient() (*http.Client, error) {
+	caBundle, err := s.caBundle()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: s.InsecureSkipTLS}
+	if caBundle != nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caBundle) {
+			return nil, errors.New("no certificates found in CA bundle")
+		}
+		tlsConfig.RootCAs = pool
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport, Timeout: 5 * time.Minute}, nil
+}
+
+// httpGet makes a GET request with basic auth if HTTPS credentials are configured,
+// returning an error if the response status is not OK.
+func (s *Sync) httpGet(url string, header http.Header) (*http.Response, error) {
+	client, err := s.httpClient()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(s.context(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if req.Header.Get("Authorization") == "" {
+		if username, password, err := s.basicAuth(); err != nil {
+			return nil, err
+		} else if password != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, &statusError{URL: url, StatusCode: resp.StatusCode, Header: resp.Header}
+	}
+	return resp, nil
+}
+
+// basicAuth returns the HTTPS credentials configured for the Sync, if any.
+func (s *Sync) basicAuth() (string, string, error) {
+	auth, err := s.auth()
+	if err != nil {
+		return "", "", err
+	}
+	if b, ok := auth.(*githttp.BasicAuth); ok {
+		return b.Username, b.Password, nil
+	}
+	return "", "", nil
+}
+
+func (s *Sync) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+type statusError struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("GET %s: %d %s", e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+}
@@ -0,0 +1,156 @@
+package sync
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPullTarball(t *testing.T) {
+	archive := tarball(t, map[string]string{"mesh.cue": "a"})
+	checksum := digest(archive)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/core.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+	mux.HandleFunc("/core.tar.gz.sha256", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s  core.tar.gz\n", strings.TrimPrefix(checksum, "sha256:"))
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	s := &Sync{GitDir: filepath.Join(t.TempDir(), "staging"), InsecureSkipTLS: true}
+	WithTarball(server.URL+"/core.tar.gz", "")(s)
+
+	rev, err := s.pullArtifact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rev.SHA != checksum {
+		t.Errorf("expected revision %s, got %s", checksum, rev.SHA)
+	}
+	if b, err := os.ReadFile(filepath.Join(s.GitDir, "mesh.cue")); err != nil || string(b) != "a" {
+		t.Errorf("expected mesh.cue to be extracted: %v", err)
+	}
+
+	s.TarballSHA256 = strings.Repeat("0", 64)
+	if _, err := s.pullArtifact(); err == nil || !strings.Contains(err.Error(), "digest mismatch") {
+		t.Errorf("expected a digest mismatch, got %v", err)
+	}
+	if _, err := os.Stat(s.GitDir); !os.IsNotExist(err) {
+		t.Errorf("expected the unverified tarball to be removed, got %v", err)
+	}
+}
+
+func TestExtractTarLimit(t *testing.T) {
+	archive := tarball(t, map[string]string{"a.cue": "12345", "b.cue": "67890"})
+
+	limit := int64(10)
+	if err := extractVerified(bytes.NewReader(archive), digest(archive), t.TempDir(), &limit); err != nil || limit != 0 {
+		t.Errorf("expected 10 bytes to be extracted, got %v with %d bytes left", err, limit)
+	}
+	limit = 9
+	if err := extractVerified(bytes.NewReader(archive), digest(archive), t.TempDir(), &limit); err == nil || !strings.Contains(err.Error(), "archive is larger than") {
+		t.Errorf("expected extraction to exceed the limit, got %v", err)
+	}
+}
+
+func TestPullOCIArtifact(t *testing.T) {
+	layer := tarball(t, map[string]string{"inputs.cue": "b", "k8s/outputs/mesh.cue": "c"})
+	layerDigest := digest(layer)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers": []map[string]string{
+			{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": layerDigest},
+		},
+	})
+	manifestDigest := digest(manifest)
+
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:greymatter/core:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"token": "t0ken"})
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer t0ken" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:greymatter/core:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/greymatter/core/manifests/1.0", "/v2/greymatter/core/manifests/" + manifestDigest:
+			w.Write(manifest)
+		case "/v2/greymatter/core/blobs/" + layerDigest:
+			w.Write(layer)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	s := &Sync{GitDir: filepath.Join(t.TempDir(), "staging"), InsecureSkipTLS: true}
+	WithOCIArtifact(strings.TrimPrefix(server.URL, "https://") + "/greymatter/core:1.0")(s)
+
+	rev, err := s.pullArtifact()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (Revision{Ref: "1.0", SHA: manifestDigest}); rev != expected {
+		t.Errorf("expected revision %s, got %s", expected, rev)
+	}
+	if b, err := os.ReadFile(filepath.Join(s.GitDir, "k8s/outputs/mesh.cue")); err != nil || string(b) != "c" {
+		t.Errorf("expected k8s/outputs/mesh.cue to be extracted: %v", err)
+	}
+}
+
+func TestParseOCIReference(t *testing.T) {
+	for ref, expected := range map[string]ociReference{
+		"registry.example.com/greymatter/core":            {"registry.example.com", "greymatter/core", "latest"},
+		"localhost:5000/core:1.0":                         {"localhost:5000", "core", "1.0"},
+		"oci://registry.example.com/core@sha256:abc":      {"registry.example.com", "core", "sha256:abc"},
+		"registry.example.com:443/greymatter/core:v1.2.0": {"registry.example.com:443", "greymatter/core", "v1.2.0"},
+	} {
+		actual, err := parseOCIReference(ref)
+		if err != nil {
+			t.Errorf("%s: %v", ref, err)
+		} else if actual != expected {
+			t.Errorf("%s: expected %+v, got %+v", ref, expected, actual)
+		}
+	}
+}
+
+func tarball(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(contents))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func digest(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
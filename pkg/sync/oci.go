@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Media types accepted for the manifest of an OCI artifact.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// ociReference is a parsed OCI artifact reference, e.g. registry.example.com/greymatter/core:1.0 or ...@sha256:<digest>.
+type ociReference struct {
+	Registry   string
+	Repository string
+	// A tag or digest.
+	Reference string
+}
+
+func parseOCIReference(ref string) (ociReference, error) {
+	ref = strings.TrimPrefix(ref, "oci://")
+	i := strings.Index(ref, "/")
+	if i < 0 {
+		return ociReference{}, fmt.Errorf("invalid OCI artifact reference %q: missing registry", ref)
+	}
+	r := ociReference{Registry: ref[:i], Repository: ref[i+1:], Reference: "latest"}
+	if i := strings.Index(r.Repository, "@"); i >= 0 {
+		r.Repository, r.Reference = r.Repository[:i], r.Repository[i+1:]
+	} else if i := strings.LastIndex(r.Repository, ":"); i >= 0 {
+		r.Repository, r.Reference = r.Repository[:i], r.Repository[i+1:]
+	}
+	if r.Repository == "" || r.Reference == "" {
+		return ociReference{}, fmt.Errorf("invalid OCI artifact reference %q", ref)
+	}
+	return r, nil
+}
+
+func (r ociReference) url(kind, reference string) string {
+	return fmt.Sprintf("https://%s/v2/%s/%s/%s", r.Registry, r.Repository, kind, reference)
+}
+
+type ociManifest struct {
+	Layers []struct {
+		MediaType string `json:"mediaType"`
+		Digest    string `json:"digest"`
+	} `json:"layers"`
+}
+
+// latestOCI returns the digest of the manifest that the OCI artifact's tag currently points to.
+func (s *Sync) latestOCI() (Revision, error) {
+	ref, err := parseOCIReference(s.OCIArtifact)
+	if err != nil {
+		return Revision{}, err
+	}
+	_, digest, err := s.getManifest(ref, ref.Reference)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev := Revision{SHA: digest}
+	if !strings.HasPrefix(ref.Reference, "sha256:") {
+		rev.Ref = ref.Reference
+	}
+	return rev, nil
+}
+
+// fetchOCI downloads the layers of the OCI artifact's manifest, verifies their digests, and extracts them into GitDir,
+// up to limit bytes in all.
+func (s *Sync) fetchOCI(rev Revision, limit *int64) error {
+	ref, err := parseOCIReference(s.OCIArtifact)
+	if err != nil {
+		return err
+	}
+	manifest, _, err := s.getManifest(ref, rev.SHA)
+	if err != nil {
+		return err
+	}
+	if len(manifest.Layers) == 0 {
+		return errors.New("OCI artifact has no layers")
+	}
+
+	for _, layer := range manifest.Layers {
+		resp, err := s.registryGet(ref, ref.url("blobs", layer.Digest), nil)
+		if err != nil {
+			return err
+		}
+		err = extractVerified(resp.Body, layer.Digest, s.GitDir, limit)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract layer %s: %w", layer.Digest, err)
+		}
+	}
+	return nil
+}
+
+// getManifest returns the manifest for a tag or digest and its digest.
+func (s *Sync) getManifest(ref ociReference, reference string) (*ociManifest, string, error) {
+	resp, err := s.registryGet(ref, ref.url("manifests", reference), http.Header{
+		"Accept": {strings.Join(manifestMediaTypes, ", ")},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, "", err
+	}
+	sum := sha256.Sum256(body)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if strings.HasPrefix(reference, "sha256:") && reference != digest {
+		return nil, "", fmt.Errorf("manifest digest mismatch: expected %s, got %s", reference, digest)
+	}
+
+	manifest := &ociManifest{}
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, "", fmt.Errorf("invalid manifest: %w", err)
+	}
+	return manifest, digest, nil
+}
+
+// registryGet makes a GET request to a registry, retrying with a bearer token if the registry requests one.
+func (s *Sync) registryGet(ref ociReference, u string, header http.Header) (*http.Response, error) {
+	resp, err := s.httpGet(u, header)
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge := statusErr.Header.Get("WWW-Authenticate")
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, err
+	}
+	token, err := s.registryToken(ref, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Authorization", "Bearer "+token)
+	return s.httpGet(u, header)
+}
+
+// registryToken requests a pull token from the realm of a registry's bearer challenge,
+// authenticating with the configured HTTPS credentials, if any.
+func (s *Sync) registryToken(ref ociReference, challenge string) (string, error) {
+	params := parseChallenge(challenge[len("bearer "):])
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("invalid bearer challenge from %s", ref.Registry)
+	}
+	q := realm.Query()
+	if params["service"] != "" {
+		q.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", ref.Repository)
+	}
+	q.Set("scope", scope)
+	realm.RawQuery = q.Encode()
+
+	resp, err := s.httpGet(realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid registry token response: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	return body.AccessToken, nil
+}
+
+// parseChallenge parses the comma-separated key="value" parameters of a WWW-Authenticate challenge.
+func parseChallenge(s string) map[string]string {
+	params := make(map[string]string)
+	for s != "" {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:end+1], s[end+2:]
+			}
+		} else if end := strings.Index(s, ","); end >= 0 {
+			value, s = s[:end], s[end:]
+		} else {
+			value, s = s, ""
+		}
+		params[key] = value
+	}
+	return params
+}
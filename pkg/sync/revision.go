@@ -0,0 +1,132 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// Revision identifies a synchronized commit and the ref it was resolved from.
+type Revision struct {
+	// The branch or tag the commit was resolved from, or empty if a commit was pinned.
+	Ref string
+	// The commit SHA.
+	SHA string
+}
+
+func (r Revision) String() string {
+	if r.Ref == "" {
+		return r.SHA
+	}
+	return fmt.Sprintf("%s@%s", r.Ref, r.SHA)
+}
+
+// pinned reports whether the Sync tracks a tag, commit, or semver constraint rather than a branch head.
+func (s *Sync) pinned() bool {
+	return s.Commit != "" || s.Tag != "" || s.SemverConstraint != ""
+}
+
+// resolve returns the revision of a fetched repository that the Sync is pinned to.
+// In order of precedence, it is the pinned commit, the pinned tag, or the highest tag matching the semver constraint.
+func (s *Sync) resolve(repo *git.Repository) (Revision, error) {
+	switch {
+	case s.Commit != "":
+		hash, err := repo.ResolveRevision(plumbing.Revision(s.Commit))
+		if err != nil {
+			return Revision{}, fmt.Errorf("failed to find commit %s: %w", s.Commit, err)
+		}
+		if _, err := repo.CommitObject(*hash); err != nil {
+			return Revision{}, fmt.Errorf("failed to find commit %s: %w", s.Commit, err)
+		}
+		return Revision{SHA: hash.String()}, nil
+
+	case s.Tag != "":
+		return resolveTag(repo, s.Tag)
+
+	case s.SemverConstraint != "":
+		constraint, err := semver.NewConstraint(s.SemverConstraint)
+		if err != nil {
+			return Revision{}, fmt.Errorf("invalid semver constraint %q: %w", s.SemverConstraint, err)
+		}
+		tags, err := repo.Tags()
+		if err != nil {
+			return Revision{}, err
+		}
+		var best *semver.Version
+		var bestTag string
+		_ = tags.ForEach(func(ref *plumbing.Reference) error {
+			name := ref.Name().Short()
+			v, err := semver.NewVersion(name)
+			if err != nil {
+				return nil // not a version tag
+			}
+			if constraint.Check(v) && (best == nil || v.GreaterThan(best)) {
+				best, bestTag = v, name
+			}
+			return nil
+		})
+		if best == nil {
+			return Revision{}, fmt.Errorf("no tags match semver constraint %q", s.SemverConstraint)
+		}
+		return resolveTag(repo, bestTag)
+	}
+
+	return Revision{}, errors.New("no tag, commit, or semver constraint to resolve")
+}
+
+// resolveTag returns the commit that a lightweight or annotated tag points to.
+func resolveTag(repo *git.Repository, name string) (Revision, error) {
+	ref, err := repo.Tag(name)
+	if err != nil {
+		return Revision{}, fmt.Errorf("failed to find tag %s: %w", name, err)
+	}
+	hash := ref.Hash()
+	if tag, err := repo.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return Revision{}, fmt.Errorf("tag %s does not point to a commit: %w", name, err)
+		}
+		hash = commit.Hash
+	}
+	return Revision{Ref: name, SHA: hash.String()}, nil
+}
+
+// checkoutPinned checks out the revision the Sync is pinned to in a fetched repository, along with its submodules.
+func (s *Sync) checkoutPinned(repo *git.Repository, opts *git.FetchOptions) (Revision, error) {
+	rev, err := s.resolve(repo)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	wt, err := repo.Worktree()
+	if err != nil {
+		return Revision{}, err
+	}
+	if err := wt.Checkout(&git.CheckoutOptions{
+		Hash:  plumbing.NewHash(rev.SHA),
+		Force: true,
+	}); err != nil {
+		return Revision{}, fmt.Errorf("failed to checkout %s: %w", rev, err)
+	}
+
+	submodules, err := wt.Submodules()
+	if err != nil {
+		return Revision{}, err
+	}
+	if err := submodules.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              opts.Auth,
+	}); err != nil {
+		return Revision{}, fmt.Errorf("failed to update submodules at %s: %w", rev, err)
+	}
+
+	if err := wt.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return Revision{}, fmt.Errorf("failed to run git clean: %w", err)
+	}
+
+	return rev, nil
+}
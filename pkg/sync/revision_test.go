@@ -0,0 +1,67 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+func TestResolve(t *testing.T) {
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "gm", Email: "gm@greymatter.io", When: time.Now()}
+
+	commits := make(map[string]plumbing.Hash)
+	for _, tag := range []string{"v1.2.0", "v1.3.1", "v2.0.0", "latest"} {
+		hash, err := wt.Commit(tag, &git.CommitOptions{Author: sig})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commits[tag] = hash
+		// Alternate between annotated and lightweight tags.
+		var opts *git.CreateTagOptions
+		if len(commits)%2 == 0 {
+			opts = &git.CreateTagOptions{Tagger: sig, Message: tag}
+		}
+		if _, err := repo.CreateTag(tag, hash, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sync     Sync
+		expected Revision
+	}{
+		{"commit", Sync{Commit: commits["v1.2.0"].String()}, Revision{SHA: commits["v1.2.0"].String()}},
+		{"lightweight tag", Sync{Tag: "v1.2.0"}, Revision{Ref: "v1.2.0", SHA: commits["v1.2.0"].String()}},
+		{"annotated tag", Sync{Tag: "v1.3.1"}, Revision{Ref: "v1.3.1", SHA: commits["v1.3.1"].String()}},
+		{"semver", Sync{SemverConstraint: "^1.2"}, Revision{Ref: "v1.3.1", SHA: commits["v1.3.1"].String()}},
+		{"commit precedes tag", Sync{Commit: commits["v2.0.0"].String(), Tag: "v1.2.0"}, Revision{SHA: commits["v2.0.0"].String()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rev, err := tc.sync.resolve(repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rev != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, rev)
+			}
+		})
+	}
+
+	if _, err := (&Sync{SemverConstraint: ">=3"}).resolve(repo); err == nil {
+		t.Error("expected an error when no tags match the semver constraint")
+	}
+}
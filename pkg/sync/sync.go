@@ -6,11 +6,19 @@ import (
 	"fmt"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 var logger = ctrl.Log.WithName("sync")
@@ -19,14 +27,62 @@ type Sync struct {
 	GitDir        string
 	SSHPrivateKey string
 	SSHPassphrase string
-	Remote        string
-	Branch        string
-	Interval      int
+	// Path to a known_hosts file for verifying SSH remotes.
+	// If not set, the user's known_hosts files are used.
+	SSHKnownHosts string
+	// Username and path to a file containing a password or access token for HTTPS remotes.
+	HTTPSUsername     string
+	HTTPSPasswordPath string
+	// Path to a PEM-encoded CA bundle trusted for HTTPS remotes in addition to the system cert pool.
+	CABundlePath string
+	// Disables TLS verification for HTTPS remotes.
+	InsecureSkipTLS bool
+	Remote          string
+	Branch          string
+	Interval        int
+
+	// Pin the synchronized revision instead of tracking the head of Branch.
+	// In order of precedence: an exact commit, a tag, or the highest tag matching a semver constraint.
+	Commit           string
+	Tag              string
+	SemverConstraint string
+
+	// Pull the CUE as an OCI artifact (e.g. registry.example.com/greymatter/core:1.0) or an HTTP tarball instead of
+	// cloning Remote. Tarballs are verified against TarballSHA256 if set, or else the sha256sum file at <TarballURL>.sha256.
+	// HTTPS credentials and TLS configuration apply to both.
+	OCIArtifact   string
+	TarballURL    string
+	TarballSHA256 string
+
+	// Require revisions to be signed by a key in an armored GPG keyring and/or an SSH
+	// authorized_keys or allowed_signers file. If VerifyTags is set, pinned tags must also be signed.
+	GPGKeyRingPath     string
+	SSHSigningKeysPath string
+	VerifyTags         bool
+
+	// If set, each revision checked out in GitDir is copied to its own directory and validated there,
+	// and ActiveDir is a symlink to the directory of the last-known-good revision.
+	ActiveDir string
+	// Validates the CUE in a directory before it is activated, e.g. with a dry-run load and extract.
+	Validate func(dir string) error
 
 	// Internal callback that is executed at the end
 	// of every sync iteration.
 	OnSyncCompleted func() error
-	ctx             context.Context
+	// Internal callback that is executed when a new revision fails validation.
+	OnSyncFailed func(rev Revision, err error)
+	ctx          context.Context
+
+	// The most recently synchronized Revision.
+	revision atomic.Value
+	// The most recent Revision that failed validation, which is not retried.
+	failed atomic.Value
+	// Wakes Watch for an immediate sync.
+	trigger chan struct{}
+
+	// If set, reads HTTPS credentials from a kubernetes.io/basic-auth Secret.
+	authSecretClient client.Client
+	authSecret       types.NamespacedName
 }
 
 // New sync will build a sync with provided constructor options.
@@ -35,9 +91,10 @@ type Sync struct {
 // will use it's default bundled config.
 func New(remote string, ctx context.Context, options ...func(*Sync)) *Sync {
 	s := &Sync{
-		Remote: remote,
-		Branch: "main", // default branch, can be overwritten
-		ctx:    ctx,
+		Remote:  remote,
+		Branch:  "main", // default branch, can be overwritten
+		ctx:     ctx,
+		trigger: make(chan struct{}, 1),
 	}
 
 	// iterate through our options and do overrides.
@@ -57,6 +114,42 @@ func WithSSHInfo(privateKeyPath, password string) func(*Sync) {
 	}
 }
 
+// WithSSHKnownHosts will verify SSH remotes against the host keys in a known_hosts file.
+func WithSSHKnownHosts(knownHostsPath string) func(*Sync) {
+	return func(s *Sync) {
+		s.SSHKnownHosts = knownHostsPath
+	}
+}
+
+// WithHTTPSAuth will set basic auth credentials for HTTPS remotes,
+// reading the password or access token (e.g. a GitHub or GitLab PAT) from a file.
+// If username is empty, "git" is used, which is accepted by token-based providers.
+func WithHTTPSAuth(username, passwordPath string) func(*Sync) {
+	return func(s *Sync) {
+		s.HTTPSUsername = username
+		s.HTTPSPasswordPath = passwordPath
+	}
+}
+
+// WithHTTPSAuthSecret will read basic auth credentials for HTTPS remotes from the
+// username and password keys of a kubernetes.io/basic-auth Secret.
+// The Secret is read on every sync, so credentials may be rotated without restarting.
+func WithHTTPSAuthSecret(c client.Client, namespace, name string) func(*Sync) {
+	return func(s *Sync) {
+		s.authSecretClient = c
+		s.authSecret = types.NamespacedName{Namespace: namespace, Name: name}
+	}
+}
+
+// WithTLSConfig will set a CA bundle trusted for HTTPS remotes in addition to the system cert pool,
+// and whether TLS verification should be skipped.
+func WithTLSConfig(caBundlePath string, insecureSkipTLS bool) func(*Sync) {
+	return func(s *Sync) {
+		s.CABundlePath = caBundlePath
+		s.InsecureSkipTLS = insecureSkipTLS
+	}
+}
+
 // WithRepoInfo will set target repository information
 // on a sync configuration object.
 func WithRepoInfo(remote, branch string) func(*Sync) {
@@ -66,6 +159,68 @@ func WithRepoInfo(remote, branch string) func(*Sync) {
 	}
 }
 
+// WithInterval will set the number of seconds between polls of the remote.
+func WithInterval(seconds int) func(*Sync) {
+	return func(s *Sync) {
+		s.Interval = seconds
+	}
+}
+
+// WithOCIArtifact will pull the CUE from the layers of an OCI artifact in a registry instead of a Git repository.
+// New digests of the artifact's tag are synchronized like new commits.
+func WithOCIArtifact(ref string) func(*Sync) {
+	return func(s *Sync) {
+		if ref != "" {
+			s.OCIArtifact = ref
+			s.Remote = ref
+		}
+	}
+}
+
+// WithTarball will pull the CUE from a tar or gzipped tar at an HTTP(S) URL instead of a Git repository.
+// If sha256 is empty, the checksum is read from <url>.sha256 on every sync, and a new checksum is synchronized like a new commit.
+func WithTarball(url, sha256 string) func(*Sync) {
+	return func(s *Sync) {
+		if url != "" {
+			s.TarballURL = url
+			s.TarballSHA256 = sha256
+			s.Remote = url
+		}
+	}
+}
+
+// WithCommit will pin the synchronized revision to an exact commit SHA.
+func WithCommit(sha string) func(*Sync) {
+	return func(s *Sync) {
+		s.Commit = sha
+	}
+}
+
+// WithTag will pin the synchronized revision to a tag.
+func WithTag(tag string) func(*Sync) {
+	return func(s *Sync) {
+		s.Tag = tag
+	}
+}
+
+// WithSemverConstraint will synchronize the highest tag matching a semver constraint, e.g. "~1.4" or ">=1.2.0, <2.0.0".
+func WithSemverConstraint(constraint string) func(*Sync) {
+	return func(s *Sync) {
+		s.SemverConstraint = constraint
+	}
+}
+
+// WithSignatureVerification will refuse to apply revisions whose commit, and tag if verifyTags is set,
+// is not signed by one of the GPG keys in an armored keyring or the SSH keys in an authorized_keys
+// or allowed_signers file. Verification is disabled if neither path is set.
+func WithSignatureVerification(gpgKeyRingPath, sshSigningKeysPath string, verifyTags bool) func(*Sync) {
+	return func(s *Sync) {
+		s.GPGKeyRingPath = gpgKeyRingPath
+		s.SSHSigningKeysPath = sshSigningKeysPath
+		s.VerifyTags = verifyTags
+	}
+}
+
 // WithOnSyncCompleted will inject a callback
 // function in the sync configuration.
 func WithOnSyncCompleted(callback func() error) func(*Sync) {
@@ -74,25 +229,83 @@ func WithOnSyncCompleted(callback func() error) func(*Sync) {
 	}
 }
 
-// Bootstrap will fetch a provided repository from the configured
+// Bootstrap will fetch a provided repository, OCI artifact, or tarball from the configured
 // bootstrap flags. Once that repository is fetched it will write out its contents
 // to disk where the operator expects its configuration to live.
 // If no bootstrap flags were provided on startup, we ignore and
 // use a bundled local configuration tree for defaults.
 func (s *Sync) Bootstrap() error {
-	if s.Remote != "" {
+	if s.artifact() {
+		if s.verifies() {
+			return errors.New("signature verification is only supported for Git repositories")
+		}
+		rev, err := s.pullArtifact()
+		if err != nil {
+			return err
+		}
+		if err := s.activate(rev); err != nil {
+			return fmt.Errorf("refusing to apply revision %s: %w", rev, err)
+		}
+		s.revision.Store(rev)
+		logger.Info("Synchronized revision", "Remote", s.Remote, "Revision", rev.String())
+	} else if s.Remote != "" {
 		err := clone(s)
 		if err != nil {
 			return err
 		}
+		repo, err := git.PlainOpen(s.GitDir)
+		if err != nil {
+			return fmt.Errorf("unable to open local repository %s: %w", s.GitDir, err)
+		}
+
+		var rev Revision
+		if s.pinned() {
+			auth, err := s.auth()
+			if err != nil {
+				return err
+			}
+			if rev, err = s.checkoutPinned(repo, &git.FetchOptions{Auth: auth}); err != nil {
+				return err
+			}
+		} else {
+			ref, err := repo.Head()
+			if err != nil {
+				return fmt.Errorf("failed to get repo HEAD: %w", err)
+			}
+			rev = Revision{Ref: s.Branch, SHA: ref.Hash().String()}
+		}
+		// There is no last-known-good revision to fall back to at startup.
+		if err := s.activate(rev); err != nil {
+			return fmt.Errorf("refusing to apply revision %s: %w", rev, err)
+		}
+		s.revision.Store(rev)
+		logger.Info("Synchronized revision", "Remote", s.Remote, "Revision", rev.String())
 	}
 
 	return nil
 }
 
+// Revision returns the commit SHA (or artifact digest) of the most recently synchronized revision,
+// or an empty string if the operator is using its bundled configuration.
+func (s *Sync) Revision() string {
+	return s.resolved().SHA
+}
+
+// Ref returns the branch or tag that the most recently synchronized revision was resolved from,
+// or an empty string if the revision is a pinned commit or the operator is using its bundled configuration.
+func (s *Sync) Ref() string {
+	return s.resolved().Ref
+}
+
+func (s *Sync) resolved() Revision {
+	r, _ := s.revision.Load().(Revision)
+	return r
+}
+
 // Watch will kick off a loop that will pull a git project for changes on an interval
-// provided by the users configuration. The default watch interval is 10s. A callback is exposed
-// in the sync configuration object that is called on a successful completion of a pull.
+// provided by the users configuration, or immediately when triggered by Trigger or WebhookHandler.
+// A callback is exposed in the sync configuration object that is called when a new revision has been validated and activated;
+// revisions that fail validation are reported to OnSyncFailed and the last-known-good revision stays active.
 // This can be used to reconcile mesh changes internally to the operator.
 // Watch uses the internal sync context to handle routine cancellation. This means that
 // the callback can also cancel this routine.
@@ -101,29 +314,57 @@ func (s *Sync) Watch() {
 		return
 	}
 
-	lastSHA := ""
 	for {
 		select {
 		case <-s.ctx.Done():
 			return
 		default:
-			currentSHA, err := gitUpdate(s)
+			var current Revision
+			var err error
+			if s.artifact() {
+				current, err = s.pullArtifact()
+			} else {
+				current, err = gitUpdate(s)
+			}
 			if err != nil {
 				logger.Error(err, fmt.Sprintf("failed while watching repo %s", s.Remote))
+			} else if current.SHA != s.Revision() && current != s.lastFailed() {
+				if err := s.activate(current); err != nil {
+					s.failed.Store(current)
+					logger.Error(err, "refusing to apply revision; keeping last-known-good revision", "Revision", current.String(), "Active", s.resolved().String())
+					if s.OnSyncFailed != nil {
+						s.OnSyncFailed(current, err)
+					}
+				} else {
+					logger.Info("Synchronized revision", "Remote", s.Remote, "Revision", current.String())
+					s.revision.Store(current)
+					if s.OnSyncCompleted != nil {
+						if err := s.OnSyncCompleted(); err != nil {
+							logger.Error(err, "failed during callback execution OnSyncCompleted()")
+						}
+					}
+				}
+			} else if current.SHA == s.Revision() {
+				// A moved tag may now resolve from a different ref.
+				s.revision.Store(current)
 			}
 
-			if s.OnSyncCompleted != nil && lastSHA != "" && lastSHA != currentSHA {
-				err = s.OnSyncCompleted()
-				if err != nil {
-					logger.Error(err, "failed during callback execution OnSyncCompleted()")
-				}
+			// Poll again after the interval, or sooner if triggered by a webhook.
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-s.trigger:
+			case <-time.After(time.Second * time.Duration(s.Interval)):
 			}
-			lastSHA = currentSHA
-			time.Sleep(time.Second * time.Duration(s.Interval))
 		}
 	}
 }
 
+func (s *Sync) lastFailed() Revision {
+	r, _ := s.failed.Load().(Revision)
+	return r
+}
+
 // clone will clone a repository given a singular sync config instance.
 func clone(s *Sync) error {
 	// if the gitdir is empty, assume cwd according to cueroot
@@ -131,66 +372,137 @@ func clone(s *Sync) error {
 		s.GitDir, _ = os.Getwd()
 	}
 
+	auth, err := s.auth()
+	if err != nil {
+		return err
+	}
+	caBundle, err := s.caBundle()
+	if err != nil {
+		return err
+	}
+
 	opts := &git.CloneOptions{
 		URL:               s.Remote,
 		ReferenceName:     plumbing.NewBranchReferenceName(s.Branch),
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth, // we need this to pull the cue config submodules
+		Auth:              auth,
+		InsecureSkipTLS:   s.InsecureSkipTLS,
+		CABundle:          caBundle,
+	}
+	// Pinned revisions are checked out after cloning the remote's default branch and all tags.
+	if s.pinned() {
+		opts.ReferenceName = ""
 	}
 
+	if _, err := git.PlainClone(s.GitDir, false, opts); err != nil {
+		return fmt.Errorf("failed to clone %s: %w", s.Remote, err)
+	}
+
+	return nil
+}
+
+// auth returns the auth method for the remote, or nil if the remote is accessed anonymously.
+func (s *Sync) auth() (transport.AuthMethod, error) {
 	if s.SSHPrivateKey != "" {
 		auth, err := ssh.NewPublicKeysFromFile("git", s.SSHPrivateKey, s.SSHPassphrase)
 		if err != nil {
-			return fmt.Errorf("failed to find private key from file: %w ", err)
+			return nil, fmt.Errorf("failed to read in ssh private key: %w", err)
+		}
+		if s.SSHKnownHosts != "" {
+			auth.HostKeyCallback, err = ssh.NewKnownHostsCallback(s.SSHKnownHosts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read in ssh known_hosts: %w", err)
+			}
 		}
-		opts.Auth = auth
-		//opts.InsecureSkipTLS = true
+		return auth, nil
+	}
 
-		_, err = git.PlainClone(s.GitDir, false, opts)
+	if s.authSecretClient != nil {
+		secret := &corev1.Secret{}
+		if err := s.authSecretClient.Get(s.ctx, s.authSecret, secret); err != nil {
+			return nil, fmt.Errorf("failed to get https auth secret %s: %w", s.authSecret, err)
+		}
+		username := string(secret.Data[corev1.BasicAuthUsernameKey])
+		if username == "" {
+			username = "git"
+		}
+		return &http.BasicAuth{Username: username, Password: string(secret.Data[corev1.BasicAuthPasswordKey])}, nil
+	}
+
+	if s.HTTPSPasswordPath != "" {
+		password, err := os.ReadFile(s.HTTPSPasswordPath)
 		if err != nil {
-			return fmt.Errorf("failed to clone with ssh: %w", err)
+			return nil, fmt.Errorf("failed to read in https password: %w", err)
 		}
-	} else {
-		if _, err := git.PlainClone(s.GitDir, false, opts); err != nil {
-			return fmt.Errorf("failed to clone without auth: %w", err)
+		username := s.HTTPSUsername
+		if username == "" {
+			username = "git"
 		}
+		return &http.BasicAuth{Username: username, Password: strings.TrimSpace(string(password))}, nil
 	}
 
-	return nil
+	return nil, nil
+}
+
+// caBundle returns the additional CA bundle trusted for HTTPS remotes, if any.
+func (s *Sync) caBundle() ([]byte, error) {
+	if s.CABundlePath == "" {
+		return nil, nil
+	}
+	caBundle, err := os.ReadFile(s.CABundlePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read in CA bundle: %w", err)
+	}
+	return caBundle, nil
 }
 
 // gitUpdate will do automatic fetching of the upstream repo
 // and apply the local changes to the specified root.
-func gitUpdate(sc *Sync) (string, error) {
+func gitUpdate(sc *Sync) (Revision, error) {
 	repo, err := git.PlainOpen(sc.GitDir)
 	if err != nil {
-		return "", fmt.Errorf("unable to open local repository %s: %w", sc.GitDir, err)
+		return Revision{}, fmt.Errorf("unable to open local repository %s: %w", sc.GitDir, err)
 	}
 
-	// FetchOptions configured with: 1) ssh private key, or 2) no auth
-	opts := &git.FetchOptions{
-		Auth:            nil,
-		InsecureSkipTLS: true,
+	auth, err := sc.auth()
+	if err != nil {
+		return Revision{}, err
+	}
+	caBundle, err := sc.caBundle()
+	if err != nil {
+		return Revision{}, err
 	}
 
-	if sc.SSHPrivateKey != "" {
-		opts.Auth, err = ssh.NewPublicKeysFromFile("git", sc.SSHPrivateKey, sc.SSHPassphrase)
-		if err != nil {
-			return "", fmt.Errorf("failed to read in ssh private key: %w", err)
+	opts := &git.FetchOptions{
+		Auth:            auth,
+		InsecureSkipTLS: sc.InsecureSkipTLS,
+		CABundle:        caBundle,
+	}
+	if sc.pinned() {
+		// Fetch all branches and tags, updating tags that have been moved.
+		opts.RefSpecs = []config.RefSpec{
+			"+refs/heads/*:refs/remotes/origin/*",
+			"+refs/tags/*:refs/tags/*",
 		}
+		opts.Tags = git.AllTags
 	}
 	if err := repo.Fetch(opts); err != nil {
 		if !errors.Is(git.NoErrAlreadyUpToDate, err) {
-			return "", fmt.Errorf("failed to fetch remote %s: %w", sc.Remote, err)
+			return Revision{}, fmt.Errorf("failed to fetch remote %s: %w", sc.Remote, err)
 		}
 	}
 
+	if sc.pinned() {
+		return sc.checkoutPinned(repo, opts)
+	}
+
 	wt, err := repo.Worktree()
 	if err != nil {
-		return "", err
+		return Revision{}, err
 	}
 	branch := plumbing.NewBranchReferenceName(sc.Branch)
 	if branch == "" {
-		return "", fmt.Errorf("missing git branch")
+		return Revision{}, fmt.Errorf("missing git branch")
 	}
 
 	// Attempt a checkout WITH create, but throw away the error. :(
@@ -210,7 +522,7 @@ func gitUpdate(sc *Sync) (string, error) {
 		Create: false,
 		Force:  true,
 	}); err != nil {
-		return "", fmt.Errorf("failed to successfully checkout: %w", err)
+		return Revision{}, fmt.Errorf("failed to successfully checkout: %w", err)
 	}
 
 	// Do the pull
@@ -220,11 +532,12 @@ func gitUpdate(sc *Sync) (string, error) {
 		SingleBranch:      true,
 		Auth:              opts.Auth,
 		Force:             true,
-		InsecureSkipTLS:   true,
+		InsecureSkipTLS:   opts.InsecureSkipTLS,
+		CABundle:          opts.CABundle,
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 	}); err != nil {
 		if !errors.Is(err, git.NoErrAlreadyUpToDate) {
-			return "", fmt.Errorf("failed to pull changes from remote: %w", err)
+			return Revision{}, fmt.Errorf("failed to pull changes from remote: %w", err)
 		}
 	}
 
@@ -232,13 +545,13 @@ func gitUpdate(sc *Sync) (string, error) {
 	if err := wt.Clean(&git.CleanOptions{
 		Dir: true,
 	}); err != nil {
-		return "", fmt.Errorf("failed to run git clean: %w", err)
+		return Revision{}, fmt.Errorf("failed to run git clean: %w", err)
 	}
 
 	// Extract the hash from this pull
 	ref, err := repo.Head()
 	if err != nil {
-		return "", fmt.Errorf("failed to get repo HEAD: %w", err)
+		return Revision{}, fmt.Errorf("failed to get repo HEAD: %w", err)
 	}
-	return ref.Hash().String(), nil
+	return Revision{Ref: sc.Branch, SHA: ref.Hash().String()}, nil
 }
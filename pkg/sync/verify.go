@@ -0,0 +1,247 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrUntrustedRevision is returned (wrapped) when a revision is unsigned or not signed by a trusted key.
+var ErrUntrustedRevision = errors.New("revision is not signed by a trusted key")
+
+const (
+	beginPGPSignature = "-----BEGIN PGP SIGNATURE-----"
+	beginSSHSignature = "-----BEGIN SSH SIGNATURE-----"
+	endSSHSignature   = "-----END SSH SIGNATURE-----"
+)
+
+// verifies reports whether the Sync requires signed revisions.
+func (s *Sync) verifies() bool {
+	return s.GPGKeyRingPath != "" || s.SSHSigningKeysPath != ""
+}
+
+// verify checks that a revision's commit, and its tag if VerifyTags is set and the revision was resolved from one,
+// is signed by one of the trusted GPG or SSH signing keys.
+func (s *Sync) verify(repo *git.Repository, rev Revision) error {
+	if !s.verifies() {
+		return nil
+	}
+
+	keys, err := s.signingKeys()
+	if err != nil {
+		return err
+	}
+
+	commit, err := repo.CommitObject(plumbing.NewHash(rev.SHA))
+	if err != nil {
+		return err
+	}
+	if commit.PGPSignature == "" {
+		return fmt.Errorf("commit %s is unsigned: %w", rev.SHA, ErrUntrustedRevision)
+	}
+	payload := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(payload); err != nil {
+		return err
+	}
+	r, err := payload.Reader()
+	if err != nil {
+		return err
+	}
+	signed, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if err := keys.verify(signed, commit.PGPSignature); err != nil {
+		return fmt.Errorf("commit %s: %v: %w", rev.SHA, err, ErrUntrustedRevision)
+	}
+
+	if s.VerifyTags && (s.Tag != "" || s.SemverConstraint != "") && rev.Ref != "" {
+		ref, err := repo.Tag(rev.Ref)
+		if err != nil {
+			return err
+		}
+		// Tag signatures are appended to the tag object, which is read raw since
+		// go-git does not separate SSH signatures from the tag message.
+		obj, err := repo.Storer.EncodedObject(plumbing.TagObject, ref.Hash())
+		if err != nil {
+			return fmt.Errorf("tag %s is lightweight and cannot be signed: %w", rev.Ref, ErrUntrustedRevision)
+		}
+		r, err := obj.Reader()
+		if err != nil {
+			return err
+		}
+		raw, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		i := bytes.Index(raw, []byte(beginPGPSignature))
+		if i < 0 {
+			i = bytes.Index(raw, []byte(beginSSHSignature))
+		}
+		if i < 0 {
+			return fmt.Errorf("tag %s is unsigned: %w", rev.Ref, ErrUntrustedRevision)
+		}
+		if err := keys.verify(raw[:i], string(raw[i:])); err != nil {
+			return fmt.Errorf("tag %s: %v: %w", rev.Ref, err, ErrUntrustedRevision)
+		}
+	}
+
+	return nil
+}
+
+type signingKeys struct {
+	gpg openpgp.EntityList
+	ssh []ssh.PublicKey
+}
+
+// signingKeys reads the trusted keys from disk, so that they may be rotated without restarting.
+func (s *Sync) signingKeys() (*signingKeys, error) {
+	keys := &signingKeys{}
+
+	if s.GPGKeyRingPath != "" {
+		f, err := os.Open(s.GPGKeyRingPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read in gpg keyring: %w", err)
+		}
+		defer f.Close()
+		if keys.gpg, err = openpgp.ReadArmoredKeyRing(f); err != nil {
+			return nil, fmt.Errorf("failed to parse gpg keyring: %w", err)
+		}
+	}
+
+	if s.SSHSigningKeysPath != "" {
+		b, err := os.ReadFile(s.SSHSigningKeysPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read in ssh signing keys: %w", err)
+		}
+		// Accepts authorized_keys or allowed_signers formats; the principals of the latter are ignored.
+		for len(bytes.TrimSpace(b)) > 0 {
+			var key ssh.PublicKey
+			key, _, _, b, err = ssh.ParseAuthorizedKey(b)
+			if err != nil {
+				break
+			}
+			keys.ssh = append(keys.ssh, key)
+		}
+		if len(keys.ssh) == 0 {
+			return nil, fmt.Errorf("no ssh signing keys found in %s", s.SSHSigningKeysPath)
+		}
+	}
+
+	return keys, nil
+}
+
+// verify checks an armored GPG or SSH signature of a payload.
+func (k *signingKeys) verify(payload []byte, signature string) error {
+	switch {
+	case strings.HasPrefix(signature, beginPGPSignature):
+		if len(k.gpg) == 0 {
+			return errors.New("signed with gpg, but no gpg keys are trusted")
+		}
+		if _, err := openpgp.CheckArmoredDetachedSignature(k.gpg, bytes.NewReader(payload), strings.NewReader(signature), nil); err != nil {
+			return err
+		}
+		return nil
+
+	case strings.HasPrefix(signature, beginSSHSignature):
+		if len(k.ssh) == 0 {
+			return errors.New("signed with ssh, but no ssh keys are trusted")
+		}
+		return verifySSHSignature(k.ssh, payload, signature)
+	}
+
+	return errors.New("unrecognized signature format")
+}
+
+// sshSignature is the blob of an armored SSH signature, following the SSHSIG magic preamble.
+// See https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+type sshSignature struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshSignedData is the data signed by an SSH signature, following the SSHSIG magic preamble.
+type sshSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+const sshSigMagic = "SSHSIG"
+
+func verifySSHSignature(trusted []ssh.PublicKey, payload []byte, armored string) error {
+	armored = strings.TrimSpace(armored)
+	armored = strings.TrimPrefix(armored, beginSSHSignature)
+	armored = strings.TrimSuffix(armored, endSSHSignature)
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(armored), ""))
+	if err != nil {
+		return fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		return errors.New("invalid ssh signature: missing magic preamble")
+	}
+
+	var sig sshSignature
+	if err := ssh.Unmarshal(blob[len(sshSigMagic):], &sig); err != nil {
+		return fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	if sig.Namespace != "git" {
+		return fmt.Errorf("ssh signature has namespace %q, not git", sig.Namespace)
+	}
+
+	key, err := ssh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	var found bool
+	for _, t := range trusted {
+		if bytes.Equal(t.Marshal(), key.Marshal()) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("signed by untrusted ssh key %s", ssh.FingerprintSHA256(key))
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("unsupported ssh signature hash algorithm %q", sig.HashAlgorithm)
+	}
+	h.Write(payload)
+
+	signed := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{
+		Namespace:     sig.Namespace,
+		Reserved:      sig.Reserved,
+		HashAlgorithm: sig.HashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...)
+
+	var signature ssh.Signature
+	if err := ssh.Unmarshal(sig.Signature, &signature); err != nil {
+		return fmt.Errorf("invalid ssh signature: %w", err)
+	}
+	return key.Verify(signed, &signature)
+}
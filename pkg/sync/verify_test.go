@@ -0,0 +1,183 @@
+package sync
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-billy/v5/memfs"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig := &object.Signature{Name: "gm", Email: "gm@greymatter.io", When: time.Now()}
+
+	// Trust a GPG key and an SSH key.
+	trustedGPG, untrustedGPG := newGPGEntity(t), newGPGEntity(t)
+	keyRing := filepath.Join(dir, "keyring.asc")
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := trustedGPG.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if err := os.WriteFile(keyRing, armored.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, trustedSSH, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, untrustedSSH, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshSigner, err := ssh.NewSignerFromKey(trustedSSH)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowedSigners := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowedSigners, append([]byte("gm@greymatter.io "), ssh.MarshalAuthorizedKey(sshSigner.PublicKey())...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	commit := func(opts *git.CommitOptions) Revision {
+		opts.Author = sig
+		hash, err := wt.Commit("commit", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Revision{SHA: hash.String()}
+	}
+	unsigned := commit(&git.CommitOptions{})
+	gpgTrusted := commit(&git.CommitOptions{SignKey: trustedGPG})
+	gpgUntrusted := commit(&git.CommitOptions{SignKey: untrustedGPG})
+	sshTrusted := sshSignedCommit(t, repo, plumbing.NewHash(gpgUntrusted.SHA), trustedSSH)
+	sshUntrusted := sshSignedCommit(t, repo, plumbing.NewHash(sshTrusted.SHA), untrustedSSH)
+
+	s := &Sync{GPGKeyRingPath: keyRing, SSHSigningKeysPath: allowedSigners}
+	for _, tc := range []struct {
+		name    string
+		rev     Revision
+		trusted bool
+	}{
+		{"unsigned", unsigned, false},
+		{"trusted gpg key", gpgTrusted, true},
+		{"untrusted gpg key", gpgUntrusted, false},
+		{"trusted ssh key", sshTrusted, true},
+		{"untrusted ssh key", sshUntrusted, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := s.verify(repo, tc.rev)
+			if tc.trusted && err != nil {
+				t.Errorf("expected revision to be trusted: %v", err)
+			}
+			if !tc.trusted && !errors.Is(err, ErrUntrustedRevision) {
+				t.Errorf("expected revision to be untrusted, got %v", err)
+			}
+		})
+	}
+
+	// Tags are verified if required.
+	if _, err := repo.CreateTag("v1.0.0", plumbing.NewHash(gpgTrusted.SHA), &git.CreateTagOptions{Tagger: sig, Message: "v1.0.0", SignKey: trustedGPG}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateTag("v1.0.1", plumbing.NewHash(gpgTrusted.SHA), nil); err != nil {
+		t.Fatal(err)
+	}
+	s.VerifyTags = true
+	s.Tag = "v1.0.0"
+	if err := s.verify(repo, Revision{Ref: "v1.0.0", SHA: gpgTrusted.SHA}); err != nil {
+		t.Errorf("expected signed tag to be trusted: %v", err)
+	}
+	s.Tag = "v1.0.1"
+	if err := s.verify(repo, Revision{Ref: "v1.0.1", SHA: gpgTrusted.SHA}); !errors.Is(err, ErrUntrustedRevision) {
+		t.Errorf("expected lightweight tag to be untrusted, got %v", err)
+	}
+}
+
+func newGPGEntity(t *testing.T) *openpgp.Entity {
+	e, err := openpgp.NewEntity("gm", "", "gm@greymatter.io", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// sshSignedCommit stores a commit signed with an SSH key, as created by git with gpg.format=ssh.
+func sshSignedCommit(t *testing.T, repo *git.Repository, parent plumbing.Hash, key ed25519.PrivateKey) Revision {
+	p, err := repo.CommitObject(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &object.Commit{
+		Author:       p.Author,
+		Committer:    p.Committer,
+		Message:      "ssh signed",
+		TreeHash:     p.TreeHash,
+		ParentHashes: []plumbing.Hash{parent},
+	}
+
+	payload := &plumbing.MemoryObject{}
+	if err := c.EncodeWithoutSignature(payload); err != nil {
+		t.Fatal(err)
+	}
+	r, _ := payload.Reader()
+	data, _ := io.ReadAll(r)
+	h := sha512.Sum512(data)
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := append([]byte(sshSigMagic), ssh.Marshal(sshSignedData{Namespace: "git", HashAlgorithm: "sha512", Hash: h[:]})...)
+	signature, err := signer.Sign(rand.Reader, signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := append([]byte(sshSigMagic), ssh.Marshal(sshSignature{
+		Version:       1,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     "git",
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(signature),
+	})...)
+	c.PGPSignature = beginSSHSignature + "\n" + base64.StdEncoding.EncodeToString(blob) + "\n" + endSSHSignature + "\n"
+
+	obj := repo.Storer.NewEncodedObject()
+	if err := c.Encode(obj); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Revision{SHA: hash.String()}
+}
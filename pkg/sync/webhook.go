@@ -0,0 +1,205 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// maxWebhookPayload bounds the size of push payloads read by the webhook handler.
+const maxWebhookPayload = 10 << 20
+
+// Trigger requests an immediate sync from Watch, without waiting for the next poll.
+// Triggers received while a sync is already pending are coalesced.
+func (s *Sync) Trigger() {
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// WebhookHandler returns an http.Handler that triggers a sync when it receives a push event
+// from GitHub, GitLab, or Bitbucket that was signed (or, for GitLab, authenticated) with secret.
+// Pushes to other branches are ignored, unless the Sync is pinned to a tag, commit, or semver constraint.
+func (s *Sync) WebhookHandler(secret []byte) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(w, "failed to read payload", http.StatusBadRequest)
+			return
+		}
+
+		var event string
+		var refs []string
+		switch {
+		case r.Header.Get("X-GitHub-Event") != "":
+			if !validHMAC(secret, body, r.Header.Get("X-Hub-Signature-256")) {
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			event = r.Header.Get("X-GitHub-Event")
+			if event == "push" {
+				refs, err = pushedRefs(body)
+			}
+
+		case r.Header.Get("X-Gitlab-Event") != "":
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Gitlab-Token")), secret) != 1 {
+				http.Error(w, "invalid token", http.StatusUnauthorized)
+				return
+			}
+			event = r.Header.Get("X-Gitlab-Event")
+			if event == "Push Hook" || event == "Tag Push Hook" {
+				event = "push"
+				refs, err = pushedRefs(body)
+			}
+
+		case r.Header.Get("X-Event-Key") != "":
+			if !validHMAC(secret, body, r.Header.Get("X-Hub-Signature")) {
+				http.Error(w, "invalid signature", http.StatusUnauthorized)
+				return
+			}
+			event = r.Header.Get("X-Event-Key")
+			if event == "repo:push" || event == "repo:refs_changed" {
+				event = "push"
+				refs, err = bitbucketPushedRefs(body)
+			}
+
+		default:
+			http.Error(w, "unrecognized webhook provider", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+
+		// Acknowledge other events, such as GitHub's ping, without syncing.
+		if event != "push" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !s.pinned() && !containsBranch(refs, s.Branch) {
+			logger.Info("Ignoring push webhook for untracked refs", "Refs", refs)
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		logger.Info("Received push webhook; triggering sync", "Refs", refs)
+		s.Trigger()
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// WebhookServer returns a manager.Runnable that serves WebhookHandler at /sync on addr until its context is cancelled,
+// with the secret read from secretPath.
+func (s *Sync) WebhookServer(addr, secretPath string) manager.Runnable {
+	return manager.RunnableFunc(func(ctx context.Context) error {
+		secret, err := os.ReadFile(secretPath)
+		if err != nil {
+			return fmt.Errorf("failed to read in sync webhook secret: %w", err)
+		}
+		if secret = bytes.TrimSpace(secret); len(secret) == 0 {
+			return fmt.Errorf("sync webhook secret %s is empty", secretPath)
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/sync", s.WebhookHandler(secret))
+		server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			<-ctx.Done()
+			server.Shutdown(context.Background())
+		}()
+
+		logger.Info("Serving sync webhook", "Addr", addr, "Path", "/sync")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+}
+
+// validHMAC reports whether header is "sha256=" followed by the hex HMAC-SHA256 of body.
+func validHMAC(secret, body []byte, header string) bool {
+	signature, err := hex.DecodeString(strings.TrimPrefix(header, "sha256="))
+	if err != nil || !strings.HasPrefix(header, "sha256=") {
+		return false
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hmac.Equal(signature, mac.Sum(nil))
+}
+
+// pushedRefs returns the ref of a GitHub or GitLab push payload.
+func pushedRefs(body []byte) ([]string, error) {
+	var payload struct {
+		Ref string `json:"ref"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return []string{payload.Ref}, nil
+}
+
+// bitbucketPushedRefs returns the refs of a Bitbucket Cloud or Bitbucket Server push payload.
+func bitbucketPushedRefs(body []byte) ([]string, error) {
+	var payload struct {
+		// Bitbucket Cloud
+		Push struct {
+			Changes []struct {
+				New *struct {
+					Type string `json:"type"`
+					Name string `json:"name"`
+				} `json:"new"`
+			} `json:"changes"`
+		} `json:"push"`
+		// Bitbucket Server
+		Changes []struct {
+			RefID string `json:"refId"`
+		} `json:"changes"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	var refs []string
+	for _, c := range payload.Push.Changes {
+		if c.New == nil {
+			continue // a deleted ref
+		}
+		if c.New.Type == "tag" {
+			refs = append(refs, "refs/tags/"+c.New.Name)
+		} else {
+			refs = append(refs, "refs/heads/"+c.New.Name)
+		}
+	}
+	for _, c := range payload.Changes {
+		refs = append(refs, c.RefID)
+	}
+	return refs, nil
+}
+
+func containsBranch(refs []string, branch string) bool {
+	for _, ref := range refs {
+		if ref == "refs/heads/"+branch {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package sync
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhookHandler(t *testing.T) {
+	secret := []byte("s3cret")
+	sign := func(body string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	for _, tc := range []struct {
+		name      string
+		headers   map[string]string
+		body      string
+		status    int
+		triggered bool
+	}{
+		{
+			name:      "github push",
+			headers:   map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(`{"ref":"refs/heads/main"}`)},
+			body:      `{"ref":"refs/heads/main"}`,
+			status:    http.StatusAccepted,
+			triggered: true,
+		},
+		{
+			name:    "github push with invalid signature",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(`{}`)},
+			body:    `{"ref":"refs/heads/main"}`,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:    "github push to another branch",
+			headers: map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": sign(`{"ref":"refs/heads/dev"}`)},
+			body:    `{"ref":"refs/heads/dev"}`,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:    "github ping",
+			headers: map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": sign(`{}`)},
+			body:    `{}`,
+			status:  http.StatusNoContent,
+		},
+		{
+			name:      "gitlab push",
+			headers:   map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "s3cret"},
+			body:      `{"ref":"refs/heads/main"}`,
+			status:    http.StatusAccepted,
+			triggered: true,
+		},
+		{
+			name:    "gitlab push with invalid token",
+			headers: map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "guess"},
+			body:    `{"ref":"refs/heads/main"}`,
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:      "bitbucket cloud push",
+			headers:   map[string]string{"X-Event-Key": "repo:push", "X-Hub-Signature": sign(`{"push":{"changes":[{"new":{"type":"branch","name":"main"}}]}}`)},
+			body:      `{"push":{"changes":[{"new":{"type":"branch","name":"main"}}]}}`,
+			status:    http.StatusAccepted,
+			triggered: true,
+		},
+		{
+			name:      "bitbucket server push",
+			headers:   map[string]string{"X-Event-Key": "repo:refs_changed", "X-Hub-Signature": sign(`{"changes":[{"refId":"refs/heads/main"}]}`)},
+			body:      `{"changes":[{"refId":"refs/heads/main"}]}`,
+			status:    http.StatusAccepted,
+			triggered: true,
+		},
+		{
+			name:   "unknown provider",
+			body:   `{}`,
+			status: http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Sync{Branch: "main", trigger: make(chan struct{}, 1)}
+			req := httptest.NewRequest(http.MethodPost, "/sync", strings.NewReader(tc.body))
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			s.WebhookHandler(secret).ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Errorf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if triggered := len(s.trigger) == 1; triggered != tc.triggered {
+				t.Errorf("expected triggered to be %t", tc.triggered)
+			}
+		})
+	}
+}
@@ -10,6 +10,10 @@ import (
 	"github.com/greymatter-io/operator/pkg/mesh_install"
 
 	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
 )
@@ -41,7 +45,6 @@ func (md *meshDefaulter) Handle(ctx context.Context, req admission.Request) admi
 }
 
 type meshValidator struct {
-	*mesh_install.Installer
 	*admission.Decoder
 	ctrlclient.Client
 }
@@ -55,13 +58,9 @@ func (mv *meshValidator) InjectDecoder(d *admission.Decoder) error {
 
 // Handle implements admission.Handler.
 // It will be invoked for validating values prior to creating or updating a Mesh.
+// Installation, updates, and removal are driven by the Mesh reconciler, not from here.
 func (mv *meshValidator) Handle(ctx context.Context, req admission.Request) admission.Response {
 	if req.Operation == admissionv1.Delete {
-		prev := &v1alpha1.Mesh{}
-		if err := mv.DecodeRaw(req.OldObject, prev); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
-		}
-		go mv.RemoveMesh(prev)
 		return admission.ValidationResponse(true, "allowed")
 	}
 
@@ -70,11 +69,32 @@ func (mv *meshValidator) Handle(ctx context.Context, req admission.Request) admi
 		return admission.Errored(http.StatusInternalServerError, err)
 	}
 
+	// Namespace labels can change after a Mesh is admitted, so only validate changes to its spec.
+	// Otherwise a Mesh whose namespaces came to conflict could never have its finalizer added or removed.
+	if req.Operation == admissionv1.Update {
+		if !mesh.DeletionTimestamp.IsZero() {
+			return admission.ValidationResponse(true, "allowed")
+		}
+		old := &v1alpha1.Mesh{}
+		if err := mv.DecodeRaw(req.OldObject, old); err != nil {
+			return admission.Errored(http.StatusInternalServerError, err)
+		}
+		if equality.Semantic.DeepEqual(old.Spec, mesh.Spec) {
+			return admission.ValidationResponse(true, "allowed")
+		}
+	}
+
 	installNS := mesh.Spec.InstallNamespace
 	if installNS == "gm-operator" {
 		return admission.ValidationResponse(false, "blocked attempt to install Mesh in 'gm-operator' namespace")
 	}
 
+	if mesh.Spec.WatchNamespaceSelector != nil {
+		if _, err := metav1.LabelSelectorAsSelector(mesh.Spec.WatchNamespaceSelector); err != nil {
+			return admission.ValidationResponse(false, fmt.Sprintf("invalid watch_namespace_selector: %v", err))
+		}
+	}
+
 	watchNS := strings.Join(mesh.Spec.WatchNamespaces, ",")
 	if strings.Contains(watchNS, installNS) {
 		return admission.ValidationResponse(false, "install namespace should not be included in watch namespaces")
@@ -109,15 +129,72 @@ func (mv *meshValidator) Handle(ctx context.Context, req admission.Request) admi
 		}
 	}
 
-	if req.Operation == admissionv1.Create {
-		go mv.ApplyMesh(nil, mesh)
-	} else {
-		prev := &v1alpha1.Mesh{}
-		if err := mv.DecodeRaw(req.OldObject, prev); err != nil {
-			return admission.Errored(http.StatusInternalServerError, err)
-		}
-		go mv.ApplyMesh(prev, mesh)
+	conflict, err := mv.selectorConflict(ctx, mesh, meshList.Items)
+	if err != nil {
+		logger.Error(err, "failed to list namespaces to validate watch_namespace_selector", "Mesh", mesh.Name)
+		return admission.ValidationResponse(false, "Internal server error; check logs with valid cluster permissions")
+	}
+	if conflict != "" {
+		return admission.ValidationResponse(false, conflict)
 	}
 
 	return admission.ValidationResponse(true, "allowed")
 }
+
+// selectorConflict describes how a Mesh's namespaces overlap with another Mesh's through the
+// watch_namespace_selector of either, or returns "" if they don't.
+func (mv *meshValidator) selectorConflict(ctx context.Context, mesh *v1alpha1.Mesh, meshes []v1alpha1.Mesh) (string, error) {
+	namespaces := &corev1.NamespaceList{}
+	if err := mv.List(ctx, namespaces); err != nil {
+		return "", err
+	}
+	labelsOf := make(map[string]labels.Set, len(namespaces.Items))
+	for _, ns := range namespaces.Items {
+		labelsOf[ns.Name] = labels.Set(ns.Labels)
+	}
+	// Namespaces that don't exist yet have no labels to select.
+	selects := func(selector labels.Selector, namespace string) bool {
+		set, ok := labelsOf[namespace]
+		return ok && selector.Matches(set)
+	}
+
+	ours := selectorOf(mesh)
+	for idx := range meshes {
+		m := &meshes[idx]
+		if m.Name == mesh.Name {
+			continue
+		}
+		theirs := selectorOf(m)
+		// Ensure this Mesh doesn't select another Mesh's install or watch namespaces
+		for _, ns := range append([]string{m.Spec.InstallNamespace}, m.Spec.WatchNamespaces...) {
+			if selects(ours, ns) {
+				return fmt.Sprintf("blocked attempt to select namespace %s with watch_namespace_selector (install or watch namespace for Mesh %s)", ns, m.Name), nil
+			}
+		}
+		// Ensure another Mesh doesn't select this Mesh's install or watch namespaces
+		for _, ns := range append([]string{mesh.Spec.InstallNamespace}, mesh.Spec.WatchNamespaces...) {
+			if selects(theirs, ns) {
+				return fmt.Sprintf("blocked attempt to include namespace %s in Mesh (selected by watch_namespace_selector of Mesh %s)", ns, m.Name), nil
+			}
+		}
+		// Ensure no namespace is selected by both Meshes
+		for _, ns := range namespaces.Items {
+			if selects(ours, ns.Name) && selects(theirs, ns.Name) {
+				return fmt.Sprintf("blocked attempt to select namespace %s with watch_namespace_selector (already selected by Mesh %s)", ns.Name, m.Name), nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// selectorOf returns a Mesh's watch_namespace_selector, which selects nothing if it is unset or invalid.
+func selectorOf(mesh *v1alpha1.Mesh) labels.Selector {
+	if mesh.Spec.WatchNamespaceSelector == nil {
+		return labels.Nothing()
+	}
+	selector, err := metav1.LabelSelectorAsSelector(mesh.Spec.WatchNamespaceSelector)
+	if err != nil {
+		return labels.Nothing()
+	}
+	return selector
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/cloudflare/cfssl/csr"
+	"github.com/greymatter-io/operator/pkg/certrotation"
 	"github.com/greymatter-io/operator/pkg/cfsslsrv"
 	"github.com/greymatter-io/operator/pkg/gmapi"
 	"github.com/greymatter-io/operator/pkg/k8sapi"
@@ -26,6 +27,10 @@ var (
 
 const (
 	defaultCSRHost = "gm-webhook.gm-operator.svc"
+
+	// How long to wait for a Mesh's Control and Catalog client before dropping a workload's sidecar configuration.
+	// This outlasts the rollout of every phase of a newly applied Mesh at the default rollout timeout.
+	sidecarConfigTimeout = 30 * time.Minute
 )
 
 type Loader struct {
@@ -34,6 +39,7 @@ type Loader struct {
 	*gmapi.CLI
 	*cfsslsrv.CFSSLServer
 	getServer func() *webhook.Server
+	rotator   *certrotation.Rotator
 	caBundle  []byte
 	cert      []byte
 	key       []byte
@@ -44,26 +50,17 @@ func New(
 	i *mesh_install.Installer,
 	c *gmapi.CLI,
 	cs *cfsslsrv.CFSSLServer,
+	rotator *certrotation.Rotator,
 	get func() *webhook.Server) (*Loader, error) {
 
-	wl := &Loader{Client: *cl, Installer: i, CLI: c, CFSSLServer: cs, getServer: get}
+	wl := &Loader{Client: *cl, Installer: i, CLI: c, CFSSLServer: cs, rotator: rotator, getServer: get}
 
 	if !i.Config.GenerateWebhookCerts {
 		logger.Info("webhook server cert generation disabled; expecting webhook server certs to be mounted from external source")
 		return wl, nil
 	}
 
-	var err error
-
-	wl.caBundle = wl.GetRootCA()
-
-	wl.cert, wl.key, err = wl.RequestCert(csr.CertificateRequest{
-		CN:         "admission",
-		Hosts:      []string{defaultCSRHost},
-		KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
-	})
-	if err != nil {
-		logger.Error(err, "failed to retrieve certs for webhook server")
+	if err := wl.requestCert(); err != nil {
 		return nil, err
 	}
 
@@ -80,14 +77,66 @@ func (wl *Loader) Start(ctx context.Context) error {
 		return nil
 	}
 
-	// Patch the opaque secret with our previously loaded signed certs
+	// Patch the webhook secret and configurations with our previously loaded signed certs.
+	// Failures are logged by k8sapi.Apply.
+	secret, _ := wl.patchCerts()
+
+	// Reissue and re-patch the certs before they expire.
+	if err := wl.rotator.Track("webhook", secret, wl.cert, func() ([]byte, error) {
+		if err := wl.requestCert(); err != nil {
+			return nil, err
+		}
+		if _, err := wl.patchCerts(); err != nil {
+			return nil, err
+		}
+		return wl.cert, nil
+	}); err != nil {
+		logger.Error(err, "webhook server certs will not be rotated")
+	}
+
+	// Since we've just patched our webhook secret, check the mounted file for changes.
+	// This lets us wait for the certwatcher to identify cert "rotation" before registering webhooks.
+	logger.Info("Waiting for certwatcher to detect new webhook TLS certs")
+	start := time.Now()
+	var byteCount int64
+	for byteCount == 0 {
+		fileInfo, _ := os.Stat("/tmp/k8s-webhook-server/serving-certs/tls.crt")
+		byteCount = fileInfo.Size()
+		time.Sleep(time.Second * 2)
+	}
+	logger.Info("New webhook TLS certs detected", "Elapsed", time.Since(start).String())
+	wl.register()
+
+	return nil
+}
+
+// requestCert retrieves a new signed cert for the webhook server.
+func (wl *Loader) requestCert() error {
+	cert, key, err := wl.RequestCert(csr.CertificateRequest{
+		CN:         "admission",
+		Hosts:      []string{defaultCSRHost},
+		KeyRequest: &csr.KeyRequest{A: "ecdsa", S: 256},
+	})
+	if err != nil {
+		logger.Error(err, "failed to retrieve certs for webhook server")
+		return err
+	}
+
+	wl.caBundle = wl.GetRootCA()
+	wl.cert, wl.key = cert, key
+	return nil
+}
+
+// patchCerts patches the webhook secret with our signed certs and the webhook configurations with our caBundle.
+// It returns the webhook secret, and an error if any patch failed.
+func (wl *Loader) patchCerts() (*corev1.Secret, error) {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      "gm-webhook-cert",
 			Namespace: "gm-operator",
 		},
 	}
-	k8sapi.Apply(&wl.Client, secret, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
+	if err := k8sapi.Apply(&wl.Client, secret, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
 		s := obj.(*corev1.Secret)
 		if s.StringData == nil {
 			s.StringData = make(map[string]string)
@@ -95,51 +144,39 @@ func (wl *Loader) Start(ctx context.Context) error {
 		s.StringData["tls.crt"] = string(wl.cert)
 		s.StringData["tls.key"] = string(wl.key)
 		return s
-	}))
+	})); err != nil {
+		return secret, err
+	}
 
-	// Patch the mutatingwebhookconfiguration with our previously loaded cabundle
 	mwc := &admissionregistrationv1.MutatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{Name: "gm-mutate-config"},
 	}
-	k8sapi.Apply(&wl.Client, mwc, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
+	if err := k8sapi.Apply(&wl.Client, mwc, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
 		m := obj.(*admissionregistrationv1.MutatingWebhookConfiguration)
 		for i := range m.Webhooks {
 			m.Webhooks[i].ClientConfig.CABundle = wl.caBundle
 		}
 		return m
-	}))
+	})); err != nil {
+		return secret, err
+	}
 
-	// Patch the validatingwebhookconfiguration with our previously loaded cabundle
 	vwc := &admissionregistrationv1.ValidatingWebhookConfiguration{
 		ObjectMeta: metav1.ObjectMeta{Name: "gm-validate-config"},
 	}
-	k8sapi.Apply(&wl.Client, vwc, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
+	err := k8sapi.Apply(&wl.Client, vwc, nil, k8sapi.MkPatchAction(func(obj client.Object) client.Object {
 		v := obj.(*admissionregistrationv1.ValidatingWebhookConfiguration)
 		for i := range v.Webhooks {
 			v.Webhooks[i].ClientConfig.CABundle = wl.caBundle
 		}
 		return v
 	}))
-
-	// Since we've just patched our webhook secret, check the mounted file for changes.
-	// This lets us wait for the certwatcher to identify cert "rotation" before registering webhooks.
-	logger.Info("Waiting for certwatcher to detect new webhook TLS certs")
-	start := time.Now()
-	var byteCount int64
-	for byteCount == 0 {
-		fileInfo, _ := os.Stat("/tmp/k8s-webhook-server/serving-certs/tls.crt")
-		byteCount = fileInfo.Size()
-		time.Sleep(time.Second * 2)
-	}
-	logger.Info("New webhook TLS certs detected", "Elapsed", time.Since(start).String())
-	wl.register()
-
-	return nil
+	return secret, err
 }
 
 func (wl *Loader) register() {
 	server := wl.getServer()
 	server.Register("/mutate-mesh", &admission.Webhook{Handler: &meshDefaulter{Installer: wl.Installer}})
-	server.Register("/validate-mesh", &admission.Webhook{Handler: &meshValidator{Installer: wl.Installer, Client: wl.Client}})
+	server.Register("/validate-mesh", &admission.Webhook{Handler: &meshValidator{Client: wl.Client}})
 	server.Register("/mutate-workload", &admission.Webhook{Handler: &workloadDefaulter{Installer: wl.Installer, CLI: wl.CLI}})
 }
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/greymatter-io/operator/pkg/cuemodule"
 	"github.com/greymatter-io/operator/pkg/gmapi"
 	"github.com/greymatter-io/operator/pkg/mesh_install"
 	"github.com/greymatter-io/operator/pkg/wellknown"
@@ -45,19 +46,9 @@ func (wd *workloadDefaulter) handlePod(req admission.Request) admission.Response
 		return admission.ValidationResponse(true, "allowed")
 	}
 
-	// If there's no mesh, don't assist deployment
-	if wd.Mesh.Name == "" || wd.Installer.Mesh.UID == "" {
-		return admission.ValidationResponse(true, "allowed")
-	}
-	// If the pod isn't in a watched namespace, don't assist deployment
-	watched := false
-	for _, ns := range wd.Mesh.Spec.WatchNamespaces {
-		if req.Namespace == ns {
-			watched = true
-			break
-		}
-	}
-	if !watched {
+	// If the pod isn't in a namespace watched by an applied mesh, don't assist deployment
+	mesh, operatorCUE, ok := wd.MeshFor(req.Namespace)
+	if !ok || req.Namespace == mesh.Spec.InstallNamespace {
 		return admission.ValidationResponse(true, "allowed")
 	}
 
@@ -72,6 +63,12 @@ func (wd *workloadDefaulter) handlePod(req admission.Request) admission.Response
 		return admission.ValidationResponse(true, "allowed")
 	}
 
+	if resp, ok := validateSidecarAnnotations(annotations); !ok {
+		return resp
+	}
+	// The overrides have just been validated.
+	overrides, _ := cuemodule.ParseSidecarOverrides(annotations)
+
 	// Check for a cluster label; if not found, this pod does not belong to a Mesh.
 	clusterLabel, ok := pod.Labels[wellknown.LABEL_CLUSTER]
 	if !ok {
@@ -86,14 +83,18 @@ func (wd *workloadDefaulter) handlePod(req admission.Request) admission.Response
 		}
 	}
 
-	container, volumes, err := wd.OperatorCUE.UnifyAndExtractSidecar(clusterLabel)
+	container, volumes, err := operatorCUE.UnifyAndExtractSidecar(clusterLabel, overrides)
 	if err != nil {
+		// Don't silently drop a sidecar that was asked to be overridden.
+		if !overrides.IsZero() {
+			return admission.ValidationResponse(false, err.Error())
+		}
 		return admission.ValidationResponse(true, "allowed")
 	}
 
 	pod.Spec.Containers = append(pod.Spec.Containers, container)
 	pod.Spec.Volumes = append(pod.Spec.Volumes, volumes...)
-	logger.Info("injected sidecar", "name", clusterLabel, "kind", "Pod", "generateName", pod.GenerateName+"*", "namespace", req.Namespace)
+	logger.Info("injected sidecar", "name", clusterLabel, "kind", "Pod", "generateName", pod.GenerateName+"*", "namespace", req.Namespace, "mesh", mesh.Name)
 
 	// Inject a reference to the image pull secret
 	var hasImagePullSecret bool
@@ -117,27 +118,12 @@ func (wd *workloadDefaulter) handlePod(req admission.Request) admission.Response
 
 // TODO: Modification should happen using a CUE package.
 func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Response {
-	// If there's no mesh, don't assist deployment
-	meshName := wd.Mesh.Name                           // wd.WatchedBy(req.Namespace)
-	if meshName == "" || wd.Installer.Mesh.UID == "" { // If the mesh isn't actually applied, don't assist deployments
-		return admission.ValidationResponse(true, "allowed")
-	}
-
-	// If the workload isn't in a watched namespace, don't assist deployment
-	// TODO also need the install namespace in here
-	watched := false
-	for _, ns := range wd.Mesh.Spec.WatchNamespaces {
-		if req.Namespace == ns {
-			watched = true
-			break
-		}
-	}
-	if req.Namespace == wd.Mesh.Spec.InstallNamespace {
-		watched = true
-	}
-	if !watched {
+	// If the workload isn't in the install or a watched namespace of an applied mesh, don't assist deployment
+	mesh, operatorCUE, ok := wd.MeshFor(req.Namespace)
+	if !ok {
 		return admission.ValidationResponse(true, "allowed")
 	}
+	meshName := mesh.Name
 
 	var rawUpdate json.RawMessage
 	var err error
@@ -147,6 +133,12 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 		deployment := &appsv1.Deployment{}
 		if req.Operation != admissionv1.Delete { // if new or updated Deployment
 			wd.Decode(req, deployment)
+			if resp, ok := validateSidecarAnnotations(deployment.Spec.Template.Annotations); !ok {
+				return resp
+			}
+			if resp, ok := validateSidecarOverrides(operatorCUE, req.Name, deployment.Spec.Template.Annotations); !ok {
+				return resp
+			}
 			if deployment.Spec.Template.Annotations == nil {
 				deployment.Spec.Template.Annotations = make(map[string]string)
 			}
@@ -163,7 +155,9 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 			_, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
 			if injectSidecar {
 				go func() {
-					wd.ConfigureSidecar(wd.OperatorCUE, req.Name, annotations)
+					ctx, cancel := context.WithTimeout(context.Background(), sidecarConfigTimeout)
+					defer cancel()
+					wd.ConfigureSidecar(ctx, operatorCUE, meshName, req.Name, annotations)
 				}()
 			}
 
@@ -174,7 +168,7 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 			_, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
 			if injectSidecar {
 				go func() {
-					wd.UnconfigureSidecar(wd.OperatorCUE, req.Name, annotations)
+					wd.UnconfigureSidecar(operatorCUE, meshName, req.Name, annotations)
 				}()
 			}
 			return admission.ValidationResponse(true, "allowed")
@@ -184,6 +178,12 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 		statefulset := &appsv1.StatefulSet{}
 		if req.Operation != admissionv1.Delete { // if new or updated StatefulSet
 			wd.Decode(req, statefulset)
+			if resp, ok := validateSidecarAnnotations(statefulset.Spec.Template.Annotations); !ok {
+				return resp
+			}
+			if resp, ok := validateSidecarOverrides(operatorCUE, req.Name, statefulset.Spec.Template.Annotations); !ok {
+				return resp
+			}
 			if statefulset.Annotations == nil {
 				statefulset.Annotations = make(map[string]string)
 			}
@@ -200,7 +200,9 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 			_, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
 			if injectSidecar {
 				go func() {
-					wd.ConfigureSidecar(wd.OperatorCUE, req.Name, annotations)
+					ctx, cancel := context.WithTimeout(context.Background(), sidecarConfigTimeout)
+					defer cancel()
+					wd.ConfigureSidecar(ctx, operatorCUE, meshName, req.Name, annotations)
 				}()
 			}
 
@@ -211,7 +213,7 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 			_, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]
 			if injectSidecar {
 				go func() {
-					wd.UnconfigureSidecar(wd.OperatorCUE, req.Name, annotations)
+					wd.UnconfigureSidecar(operatorCUE, meshName, req.Name, annotations)
 				}()
 			}
 			return admission.ValidationResponse(true, "allowed")
@@ -221,6 +223,39 @@ func (wd *workloadDefaulter) handleWorkload(req admission.Request) admission.Res
 	return admission.PatchResponseFromRaw(req.Object.Raw, rawUpdate)
 }
 
+// validateSidecarAnnotations rejects a workload whose pod template requests an injected sidecar
+// with upstream port or sidecar override annotations that have bad values.
+func validateSidecarAnnotations(annotations map[string]string) (admission.Response, bool) {
+	_, _, injectSidecar, err := cuemodule.ParseUpstreams(annotations)
+	if !injectSidecar {
+		return admission.Response{}, true
+	}
+	if err != nil {
+		return admission.ValidationResponse(false, err.Error()), false
+	}
+	if _, err := cuemodule.ParseSidecarOverrides(annotations); err != nil {
+		return admission.ValidationResponse(false, err.Error()), false
+	}
+	return admission.Response{}, true
+}
+
+// validateSidecarOverrides rejects a workload whose sidecar overrides fail to unify with the sidecar CUE,
+// so that the workload itself is rejected rather than each of its Pods.
+// It expects the annotations to have been validated by validateSidecarAnnotations.
+func validateSidecarOverrides(operatorCUE *cuemodule.OperatorCUE, clusterName string, annotations map[string]string) (admission.Response, bool) {
+	if _, injectSidecar := annotations[wellknown.ANNOTATION_INJECT_SIDECAR_TO_PORT]; !injectSidecar {
+		return admission.Response{}, true
+	}
+	overrides, err := cuemodule.ParseSidecarOverrides(annotations)
+	if err != nil || overrides.IsZero() {
+		return admission.Response{}, true
+	}
+	if _, _, err := operatorCUE.UnifyAndExtractSidecar(clusterName, overrides); err != nil {
+		return admission.ValidationResponse(false, err.Error()), false
+	}
+	return admission.Response{}, true
+}
+
 func addClusterLabels(tmpl corev1.PodTemplateSpec, meshName, clusterName string) corev1.PodTemplateSpec {
 	if tmpl.Labels == nil {
 		tmpl.Labels = make(map[string]string)
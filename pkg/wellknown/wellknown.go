@@ -6,4 +6,17 @@ const (
 	ANNOTATION_LAST_APPLIED           = "greymatter.io/last-applied"
 	LABEL_CLUSTER                     = "greymatter.io/cluster"
 	LABEL_WORKLOAD                    = "greymatter.io/workload"
+	LABEL_CUE_OVERLAY                 = "greymatter.io/cue-overlay"         // marks a ConfigMap of CUE overlays; its value is the target (k8s or gm)
+	FINALIZER_MESH_CLEANUP            = "greymatter.io/mesh-cleanup"        // blocks Mesh deletion until its components are removed
+	LABEL_MESH                        = "greymatter.io/mesh"                // the Mesh that an object was applied for
+	LABEL_INVENTORY                   = "greymatter.io/inventory"           // the CUE revision that an object was last applied from
+	ANNOTATION_PRUNE                  = "greymatter.io/prune"               // "disabled" to never prune an object, or "dry-run" to only report it
+	ANNOTATION_DRIFT_CORRECTION       = "greymatter.io/drift-correction"    // "disabled" to keep changes made to an object outside of the CUE
+	ANNOTATION_ROLLOUT_PHASE          = "greymatter.io/rollout-phase"       // the rollout phase of a core manifest, overriding the one inferred from its kind and name
+	ANNOTATION_SIDECAR_CPU            = "greymatter.io/sidecar-cpu"         // CPU request and limit of an injected sidecar, e.g. "500m"
+	ANNOTATION_SIDECAR_MEMORY         = "greymatter.io/sidecar-memory"      // memory request and limit of an injected sidecar, e.g. "256Mi"
+	ANNOTATION_SIDECAR_IMAGE          = "greymatter.io/sidecar-image"       // image of an injected sidecar, overriding the CUE's
+	ANNOTATION_SIDECAR_LOG_LEVEL      = "greymatter.io/sidecar-log-level"   // log level of an injected sidecar, e.g. "debug"
+	ANNOTATION_SIDECAR_EXTRA_PORTS    = "greymatter.io/sidecar-extra-ports" // additional ports of an injected sidecar, e.g. "metrics:8081,admin:8001/TCP"
+	ANNOTATION_UPSTREAM_PORTS         = "greymatter.io/upstream-ports"      // named upstream ports and protocols behind an injected sidecar, e.g. "api:8080,rpc:9090/grpc,db:5432/tcp"
 )